@@ -2,26 +2,25 @@ package sequel
 
 import (
 	"database/sql"
+	"fmt"
 	"reflect"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/pkg/errors"
+
+	"github.com/alecthomas/sequel/internal/syntax"
 )
 
 var (
-	scannerType   = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
-	timeType      = reflect.TypeOf(time.Time{})
-	byteSliceType = reflect.TypeOf([]byte{})
-
-	// Cache of row builders.
-	rowBuilderCache = map[reflect.Type]*builder{}
-	rowBuilderLock  sync.RWMutex
+	scannerType    = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	tableNamerType = reflect.TypeOf((*tableNamer)(nil)).Elem()
+	timeType       = reflect.TypeOf(time.Time{})
+	byteSliceType  = reflect.TypeOf([]byte{})
 )
 
 // Creates a function that can efficiently construct field references for use with sql.Rows.Scan(...).
-func makeRowBuilder(v interface{}) (*builder, error) {
+func (m *mapper) makeRowBuilder(v interface{}) (*builder, error) {
 	t := indirectType(reflect.TypeOf(v))
 	if t.Kind() == reflect.Slice {
 		t = t.Elem()
@@ -29,17 +28,17 @@ func makeRowBuilder(v interface{}) (*builder, error) {
 	if t.Kind() != reflect.Struct {
 		return nil, errors.Errorf("can only scan into pointer to struct or slice of same, not %s", t)
 	}
-	return makeRowBuilderForType(t)
+	return m.makeRowBuilderForType(t)
 }
 
 // Creates a function that can efficiently construct field references for use with sql.Rows.Scan(...).
-func makeRowBuilderForSlice(slice interface{}) (*builder, error) {
+func (m *mapper) makeRowBuilderForSlice(slice interface{}) (*builder, error) {
 	t := reflect.TypeOf(slice)
 	if t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Slice || indirectType(t.Elem().Elem()).Kind() != reflect.Struct {
 		return nil, errors.Errorf("expected a pointer to a slice of structs but got %T", slice)
 	}
 	t = t.Elem().Elem()
-	return makeRowBuilderForType(t)
+	return m.makeRowBuilderForType(t)
 }
 
 func indirectType(t reflect.Type) reflect.Type {
@@ -58,7 +57,7 @@ func indirectValue(v reflect.Value) reflect.Value {
 	return v
 }
 
-func makeRowBuilderForType(t reflect.Type) (*builder, error) {
+func (m *mapper) makeRowBuilderForType(t reflect.Type) (*builder, error) {
 	t = indirectType(t)
 	if t.Kind() == reflect.Slice {
 		t = t.Elem()
@@ -66,21 +65,32 @@ func makeRowBuilderForType(t reflect.Type) (*builder, error) {
 	if t.Kind() != reflect.Struct {
 		return nil, errors.Errorf("can only build rows for structs not %s", t)
 	}
-	rowBuilderLock.RLock()
-	if builder, ok := rowBuilderCache[t]; ok {
-		rowBuilderLock.RUnlock()
+	return m.cachedRowBuilder(t)
+}
+
+func (m *mapper) cachedRowBuilder(t reflect.Type) (*builder, error) {
+	c := m.cache
+	generation := codecGeneration()
+	c.lock.RLock()
+	if builder, ok := c.builders[t]; ok && c.generation == generation {
+		c.lock.RUnlock()
 		return builder, nil
 	}
-	rowBuilderLock.RUnlock()
+	c.lock.RUnlock()
 
 	// Upgrade and check it again :\
-	rowBuilderLock.Lock()
-	defer rowBuilderLock.Unlock()
-	if builder, ok := rowBuilderCache[t]; ok {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	// Codecs registered since the builders were cached may change how fields are mapped.
+	if c.generation != generation {
+		c.builders = map[reflect.Type]*builder{}
+		c.generation = generation
+	}
+	if builder, ok := c.builders[t]; ok {
 		return builder, nil
 	}
 
-	fields, err := collectFieldIndexes(t)
+	fields, err := m.collectFieldIndexes(t)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to collect field indexes")
 	}
@@ -88,7 +98,7 @@ func makeRowBuilderForType(t reflect.Type) (*builder, error) {
 	fieldNames := []string{}
 	pk := ""
 	for _, field := range fields {
-		if field.pk {
+		if field.pk && field.table == "" {
 			pk = field.name
 		}
 		fieldNames = append(fieldNames, field.name)
@@ -100,11 +110,11 @@ func makeRowBuilderForType(t reflect.Type) (*builder, error) {
 		fieldMap: fieldMap,
 		pk:       pk,
 	}
-	rowBuilderCache[t] = b
+	c.builders[t] = b
 	return b, nil
 }
 
-func collectFieldIndexes(t reflect.Type) ([]field, error) {
+func (m *mapper) collectFieldIndexes(t reflect.Type) ([]field, error) {
 	out := []field{}
 	for i := 0; i < t.NumField(); i++ {
 		f := t.Field(i)
@@ -114,8 +124,19 @@ func collectFieldIndexes(t reflect.Type) ([]field, error) {
 			continue
 		}
 
-		if ft == timeType || ft == byteSliceType || ft.Implements(scannerType) || reflect.PtrTo(ft).Implements(scannerType) {
-			fld, err := parseField(f, []int{i})
+		if codec := lookupCodec(ft); codec != nil {
+			fld, err := m.parseScalarField(f, []int{i})
+			if err != nil {
+				return nil, err
+			}
+			fld.codec = codec
+			out = append(out, fld)
+			continue
+		}
+
+		if ft == timeType || ft == byteSliceType || ft.Implements(scannerType) || reflect.PtrTo(ft).Implements(scannerType) ||
+			isByteArrayType(ft) || hasTagOption(f, "json") || hasTagOption(f, "array") {
+			fld, err := m.parseScalarField(f, []int{i})
 			if err != nil {
 				return nil, err
 			}
@@ -123,17 +144,44 @@ func collectFieldIndexes(t reflect.Type) ([]field, error) {
 			continue
 		}
 
+		// Pointers to structs are nested structs that are nil if all of their columns are NULL,
+		// eg. for LEFT JOINs.
+		nullable := ft.Kind() == reflect.Ptr && ft.Elem().Kind() == reflect.Struct && ft.Elem() != timeType
+		if nullable {
+			ft = ft.Elem()
+		}
+
 		switch ft.Kind() {
 		case reflect.Struct:
-			if !f.Anonymous {
-				return nil, errors.Errorf("struct field \"%s %s\" must implement sql.Scanner to be mapped to a field", f.Name, ft)
-			}
-			sub, err := collectFieldIndexes(ft)
+			sub, err := m.collectFieldIndexes(ft)
 			if err != nil {
 				return nil, err
 			}
+			// Named struct fields are mapped to columns prefixed with the field name, eg. "acct_id".
+			prefix, table, name := "", "", ""
+			if !f.Anonymous {
+				group, err := m.parseField(f, []int{i})
+				if err != nil {
+					return nil, err
+				}
+				if group.pk || group.managed {
+					return nil, errors.Errorf("field %s: struct fields can not be tagged pk or managed", f.Name)
+				}
+				prefix = group.name + "_"
+				table = group.name
+				name = group.name
+				if reflect.PtrTo(ft).Implements(tableNamerType) {
+					table = reflect.New(ft).Interface().(tableNamer).TableName()
+				}
+			}
 			for _, field := range sub {
 				field.index = append([]int{i}, field.index...)
+				field.name = prefix + field.name
+				field.nullable = field.nullable || nullable
+				if field.table == "" {
+					field.table = table
+					field.group = name
+				}
 				out = append(out, field)
 			}
 
@@ -141,7 +189,7 @@ func collectFieldIndexes(t reflect.Type) ([]field, error) {
 			return nil, errors.Errorf("can't select into slice field \"%s %s\"", f.Name, ft)
 
 		default:
-			fld, err := parseField(f, []int{i})
+			fld, err := m.parseScalarField(f, []int{i})
 			if err != nil {
 				return nil, err
 			}
@@ -152,36 +200,87 @@ func collectFieldIndexes(t reflect.Type) ([]field, error) {
 	return out, nil
 }
 
-func parseField(f reflect.StructField, index []int) (field, error) {
-	name := strings.ToLower(strings.Join(camelCase(f.Name), "_"))
-	tag, ok := f.Tag.Lookup("db")
-	out := field{name: name, index: index}
+func (m *mapper) parseScalarField(f reflect.StructField, index []int) (field, error) {
+	fld, err := m.parseField(f, index)
+	if err != nil {
+		return field{}, err
+	}
+	if fld.prefix {
+		return field{}, errors.Errorf("field %s: only struct fields can be tagged prefix", f.Name)
+	}
+	return fld, nil
+}
+
+func hasTagOption(f reflect.StructField, option string) bool {
+	tag, err := syntax.ParseTag(f.Tag.Get("db"))
+	if err != nil {
+		return false
+	}
+	switch option {
+	case "json":
+		return tag.JSON
+	case "array":
+		return tag.Array
+	}
+	return false
+}
+
+func (m *mapper) parseField(f reflect.StructField, index []int) (field, error) {
+	name := m.names(f.Name)
+	out := field{name: name, column: name, index: index, t: f.Type}
+	value, ok := f.Tag.Lookup("db")
 	if !ok {
 		return out, nil
 	}
 
-	parts := strings.Split(tag, ",")
-	if parts[0] != "" {
-		out.name = parts[0]
+	tag, err := syntax.ParseTag(value)
+	if err != nil {
+		return field{}, errors.Errorf("field %s: %s", f.Name, err)
 	}
-	for _, part := range parts[1:] {
-		switch part {
-		case "managed":
-			out.managed = true
-		case "pk":
-			out.pk = true
-		default:
-			return field{}, errors.Errorf("field %s: invalid tag attribute %q", f.Name, part)
-		}
+	if tag.Name != "" {
+		out.name = tag.Name
+		out.column = tag.Name
+	}
+	if tag.Array && (f.Type.Kind() != reflect.Slice || f.Type == byteSliceType) {
+		return field{}, errors.Errorf("field %s: only slice fields can be tagged array", f.Name)
+	}
+	if tag.UUID && (!isByteArrayType(f.Type) || f.Type.Len() != 16) {
+		return field{}, errors.Errorf("field %s: only [16]byte fields can be tagged uuid", f.Name)
 	}
+	out.managed = tag.Managed
+	out.pk = tag.PK
+	out.prefix = tag.Prefix
+	out.json = tag.JSON
+	out.array = tag.Array
+	out.uuid = tag.UUID
 	return out, nil
 }
 
 type field struct {
-	name    string
+	// Name of the result column this field maps to, including any prefix.
+	name string
+	// Column and table (or alias) for fields in nested structs, used when expanding "**".
+	column string
+	table  string
+	// Name of the nested struct field the field is mapped from, if any.
+	group   string
 	index   []int
+	t       reflect.Type
 	managed bool
 	pk      bool
+	prefix  bool
+	json    bool
+	array   bool
+	uuid    bool
+	codec   *codec
+	// Field is within a nested struct pointer.
+	nullable bool
+}
+
+// Types mapped by nested struct fields may implement tableNamer to qualify their columns when
+// expanding "**". Otherwise the field name is used as the table alias.
+type tableNamer interface {
+	TableName() string
 }
 
 type builder struct {
@@ -201,24 +300,151 @@ func (b *builder) filteredFields(withManaged bool) []string {
 	return out
 }
 
-func (b *builder) fill(v interface{}, columns []string) (out []interface{}) {
-	rv := reflect.ValueOf(v).Elem()
-	out = make([]interface{}, len(b.fields))
-	for i, column := range columns {
-		out[i] = rv.FieldByIndex(b.fieldMap[column].index).Addr().Interface()
+// Returns an error if b has fields of nested structs, which map to the columns of other tables and so
+// can't be inserted or updated.
+func (b *builder) checkMutable() error {
+	for _, name := range b.fields {
+		if field := b.fieldMap[name]; field.table != "" {
+			return errors.Errorf("can't insert or update %s: field %q is of a nested struct", b.t, name)
+		}
 	}
-	return
+	return nil
 }
 
-func (b *builder) build(columns []string) (reflect.Value, []interface{}) {
-	out := make([]interface{}, len(columns))
-	v := reflect.New(b.t).Elem()
+// Columns for a "**" expansion. Fields of nested structs are table qualified and aliased.
+//
+// If "table" is provided, eg. "u.**", only the fields of nested structs mapped to that table or
+// alias, or with that field name, are expanded, qualified with "table". If there are no such fields,
+// all other fields are expanded, qualified with "table".
+//
+// If "alias" is provided, eg. "**(u)", it is used as the table, and other fields are also aliased
+// with it as a prefix, eg. "u.id AS u_id", for mapping to nested structs.
+func (b *builder) columns(d dialect, table, alias string) (string, error) {
+	if table == "" && alias == "" {
+		out := make([]string, len(b.fields))
+		for i, name := range b.fields {
+			field := b.fieldMap[name]
+			if field.table == "" {
+				out[i] = d.QuoteID(name)
+			} else {
+				out[i] = fmt.Sprintf("%s.%s AS %s", d.QuoteID(field.table), d.QuoteID(field.column), d.QuoteID(name))
+			}
+		}
+		return strings.Join(out, ", "), nil
+	}
+	if table == "" {
+		table = alias
+	}
+	nested := []string{}
+	other := []string{}
+	for _, name := range b.fields {
+		field := b.fieldMap[name]
+		switch {
+		case field.table == table || field.group == table:
+			nested = append(nested, fmt.Sprintf("%s.%s AS %s", d.QuoteID(table), d.QuoteID(field.column), d.QuoteID(name)))
+		case field.table != "":
+		case alias != "":
+			other = append(other, fmt.Sprintf("%s.%s AS %s", d.QuoteID(table), d.QuoteID(field.column), d.QuoteID(alias+"_"+name)))
+		default:
+			other = append(other, fmt.Sprintf("%s.%s", d.QuoteID(table), d.QuoteID(field.column)))
+		}
+	}
+	if len(nested) > 0 {
+		return strings.Join(nested, ", "), nil
+	}
+	if len(other) == 0 {
+		return "", errors.Errorf("no fields of %s map to table %q", b.t, table)
+	}
+	return strings.Join(other, ", "), nil
+}
+
+// Scan the current row into v, which must be an addressable value of the builder's type.
+func (b *builder) scan(m *mapper, rows *sql.Rows, v reflect.Value, columns []string) error {
+	values := make([]interface{}, len(columns))
+	// Temporaries for fields of nested struct pointers, which are only allocated for non-NULL values.
+	temps := make([]reflect.Value, len(columns))
 	for i, column := range columns {
 		field, ok := b.fieldMap[column]
 		if !ok {
-			panic("unmapped field" + column)
+			// Only permitted by IgnoreUnmappedColumns.
+			values[i] = discardScanner{}
+			continue
+		}
+		if !field.nullable {
+			values[i] = m.fieldScanner(field, v.FieldByIndex(field.index))
+			continue
+		}
+		temps[i] = reflect.New(field.t).Elem()
+		if scanner, ok := m.fieldScanner(field, temps[i]).(sql.Scanner); ok {
+			values[i] = &nullScanner{scanner: scanner}
+		} else {
+			values[i] = reflect.New(reflect.PtrTo(field.t)).Interface()
+		}
+	}
+	if err := rows.Scan(values...); err != nil {
+		return err
+	}
+	for i, value := range values {
+		if !temps[i].IsValid() {
+			continue
+		}
+		if scanner, ok := value.(*nullScanner); ok {
+			if !scanner.valid {
+				continue
+			}
+		} else if ref := reflect.ValueOf(value).Elem(); ref.IsNil() {
+			continue
+		} else {
+			temps[i].Set(ref.Elem())
+		}
+		fieldByIndexAlloc(v, b.fieldMap[columns[i]].index).Set(temps[i])
+	}
+	return nil
+}
+
+// Discards the value of an unmapped column.
+type discardScanner struct{}
+
+func (discardScanner) Scan(src interface{}) error { return nil }
+
+// Records whether a scanned value was NULL.
+type nullScanner struct {
+	scanner sql.Scanner
+	valid   bool
+}
+
+func (n *nullScanner) Scan(src interface{}) error {
+	if src == nil {
+		return nil
+	}
+	n.valid = true
+	return n.scanner.Scan(src)
+}
+
+// Like reflect.Value.FieldByIndex, but allocates nil struct pointers.
+func fieldByIndexAlloc(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// Like reflect.Value.FieldByIndex, but returns false rather than panicking on nil struct pointers.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
 		}
-		out[i] = v.FieldByIndex(field.index).Addr().Interface()
+		v = v.Field(x)
 	}
-	return v, out
+	return v, true
 }
@@ -0,0 +1,148 @@
+// Command sequel-gen generates Go structs for mapping the tables of a database with Sequel.
+//
+// eg.
+//
+// 		sequel-gen -driver sqlite3 -dsn ./app.db -package models -o models/tables.go
+//
+// Each table is mapped to a struct with a TableName() method, and a field for each column tagged with
+// its name. Single integer primary key columns are tagged "pk", and columns with a default or
+// auto-increment value are tagged "managed". Nullable columns are mapped to sql.Null* types, or pointers with "-nullable=pointer".
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	_ "github.com/go-sql-driver/mysql" // imported for side-effects
+	_ "github.com/lib/pq"              // imported for side-effects
+	_ "github.com/mattn/go-sqlite3"    // imported for side-effects
+	"github.com/pkg/errors"
+
+	"github.com/alecthomas/sequel"
+	"github.com/alecthomas/sequel/internal/codegen"
+)
+
+type config struct {
+	pkg      string
+	tables   []string
+	pointers bool
+}
+
+func main() {
+	driver := flag.String("driver", "sqlite3", "SQL driver (sqlite3, mysql or postgres).")
+	dsn := flag.String("dsn", "", "Data source name to connect to.")
+	pkg := flag.String("package", "models", "Package name of the generated code.")
+	tables := flag.String("tables", "", "Comma separated list of tables to generate structs for (default all).")
+	nullable := flag.String("nullable", "sql", "Map nullable columns to sql.Null* types (sql) or pointers (pointer).")
+	output := flag.String("o", "", "File to write generated code to (default stdout).")
+	flag.Parse()
+
+	cfg := config{pkg: *pkg, pointers: *nullable == "pointer"}
+	if *tables != "" {
+		cfg.tables = strings.Split(*tables, ",")
+	}
+	if *nullable != "sql" && *nullable != "pointer" {
+		fatalf("invalid -nullable value %q", *nullable)
+	}
+	if *dsn == "" {
+		fatalf("-dsn is required")
+	}
+
+	db, err := sequel.Open(*driver, *dsn)
+	if err != nil {
+		fatalf("%s", err)
+	}
+	defer db.Close()
+
+	w := io.Writer(os.Stdout)
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fatalf("%s", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := generate(w, db, cfg); err != nil {
+		fatalf("%s", err)
+	}
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "sequel-gen: error: "+format+"\n", args...)
+	os.Exit(1)
+}
+
+// Generate structs for the tables in db.
+func generate(w io.Writer, db *sequel.DB, cfg config) error {
+	tables := cfg.tables
+	if len(tables) == 0 {
+		var err error
+		tables, err = db.Tables()
+		if err != nil {
+			return err
+		}
+	}
+	imports := map[string]bool{}
+	body := &bytes.Buffer{}
+	for _, table := range tables {
+		columns, err := db.Columns(table)
+		if err != nil {
+			return err
+		}
+		if len(columns) == 0 {
+			return errors.Errorf("table %q does not exist", table)
+		}
+		pk := primaryKey(columns)
+		name := codegen.GoName(table)
+		fmt.Fprintf(body, "\n// %s maps rows of the %s table.\n", name, table)
+		fmt.Fprintf(body, "type %s struct {\n", name)
+		for _, column := range columns {
+			t, pkg := codegen.GoType(column, cfg.pointers)
+			if pkg != "" {
+				imports[pkg] = true
+			}
+			fmt.Fprintf(body, "\t%s %s `db:\"%s\"`\n", codegen.GoName(column.Name), t, tag(column, column.Name == pk))
+		}
+		fmt.Fprintf(body, "}\n\n")
+		fmt.Fprintf(body, "// TableName returns the name of the table %s is mapped to.\n", name)
+		fmt.Fprintf(body, "func (%s) TableName() string { return %q }\n", name, table)
+	}
+
+	return codegen.Write(w, "sequel-gen", cfg.pkg, imports, body.Bytes())
+}
+
+// Returns the name of the column to tag "pk", if the table's primary key is a single integer column.
+//
+// Sequel sets the "pk" field to the ID of inserted rows, so composite and non-integer keys are not tagged.
+func primaryKey(columns []sequel.Column) string {
+	pk := ""
+	for _, column := range columns {
+		if !column.PrimaryKey {
+			continue
+		}
+		if pk != "" {
+			return ""
+		}
+		pk = column.Name
+		if codegen.ScalarType(column.Type) != "int64" {
+			return ""
+		}
+	}
+	return pk
+}
+
+func tag(column sequel.Column, pk bool) string {
+	out := column.Name
+	if pk {
+		out += ",pk"
+	}
+	if column.HasDefault || column.AutoIncrement {
+		out += ",managed"
+	}
+	return out
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/alecthomas/sequel"
+)
+
+const fixtureSchema = `
+CREATE TABLE users (
+	id INTEGER PRIMARY KEY,
+	name VARCHAR(255),
+	email TEXT NOT NULL,
+	avatar_url TEXT NOT NULL DEFAULT '',
+	created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	last_login TIMESTAMP
+);
+
+CREATE TABLE user_groups (
+	user_id INTEGER NOT NULL REFERENCES users (id),
+	group_name TEXT NOT NULL,
+	score REAL,
+	admin BOOLEAN NOT NULL,
+	avatar BLOB,
+	dues DECIMAL(10, 2),
+	PRIMARY KEY (user_id, group_name)
+);
+`
+
+// Copies of the structs generated for fixtureSchema, for round-tripping rows through Sequel.
+type UserGroups struct {
+	UserID    int64           `db:"user_id"`
+	GroupName string          `db:"group_name"`
+	Score     sql.NullFloat64 `db:"score"`
+	Admin     bool            `db:"admin"`
+	Avatar    []byte          `db:"avatar"`
+	Dues      sql.NullString  `db:"dues"`
+}
+
+func (UserGroups) TableName() string { return "user_groups" }
+
+type Users struct {
+	ID        int64          `db:"id,pk,managed"`
+	Name      sql.NullString `db:"name"`
+	Email     string         `db:"email"`
+	AvatarURL string         `db:"avatar_url,managed"`
+	Created   time.Time      `db:"created,managed"`
+	LastLogin sql.NullTime   `db:"last_login"`
+}
+
+func (Users) TableName() string { return "users" }
+
+func TestGenerate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sequel-gen-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	db, err := sequel.Open("sqlite3", filepath.Join(dir, "fixture.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.DB.Exec(fixtureSchema)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		cfg      config
+		expected string
+	}{
+		{name: "AllTables",
+			cfg: config{pkg: "models"},
+			expected: `// Code generated by sequel-gen. DO NOT EDIT.
+
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// UserGroups maps rows of the user_groups table.
+type UserGroups struct {
+	UserID    int64           ` + "`" + `db:"user_id"` + "`" + `
+	GroupName string          ` + "`" + `db:"group_name"` + "`" + `
+	Score     sql.NullFloat64 ` + "`" + `db:"score"` + "`" + `
+	Admin     bool            ` + "`" + `db:"admin"` + "`" + `
+	Avatar    []byte          ` + "`" + `db:"avatar"` + "`" + `
+	Dues      sql.NullString  ` + "`" + `db:"dues"` + "`" + `
+}
+
+// TableName returns the name of the table UserGroups is mapped to.
+func (UserGroups) TableName() string { return "user_groups" }
+
+// Users maps rows of the users table.
+type Users struct {
+	ID        int64          ` + "`" + `db:"id,pk,managed"` + "`" + `
+	Name      sql.NullString ` + "`" + `db:"name"` + "`" + `
+	Email     string         ` + "`" + `db:"email"` + "`" + `
+	AvatarURL string         ` + "`" + `db:"avatar_url,managed"` + "`" + `
+	Created   time.Time      ` + "`" + `db:"created,managed"` + "`" + `
+	LastLogin sql.NullTime   ` + "`" + `db:"last_login"` + "`" + `
+}
+
+// TableName returns the name of the table Users is mapped to.
+func (Users) TableName() string { return "users" }
+`},
+		{name: "PointersForSelectedTables",
+			cfg: config{pkg: "db", tables: []string{"users"}, pointers: true},
+			expected: `// Code generated by sequel-gen. DO NOT EDIT.
+
+package db
+
+import (
+	"time"
+)
+
+// Users maps rows of the users table.
+type Users struct {
+	ID        int64      ` + "`" + `db:"id,pk,managed"` + "`" + `
+	Name      *string    ` + "`" + `db:"name"` + "`" + `
+	Email     string     ` + "`" + `db:"email"` + "`" + `
+	AvatarURL string     ` + "`" + `db:"avatar_url,managed"` + "`" + `
+	Created   time.Time  ` + "`" + `db:"created,managed"` + "`" + `
+	LastLogin *time.Time ` + "`" + `db:"last_login"` + "`" + `
+}
+
+// TableName returns the name of the table Users is mapped to.
+func (Users) TableName() string { return "users" }
+`},
+	}
+	for _, test := range tests {
+		// nolint: scopelint
+		t.Run(test.name, func(t *testing.T) {
+			w := &bytes.Buffer{}
+			err := generate(w, db, test.cfg)
+			require.NoError(t, err)
+			require.Equal(t, test.expected, w.String())
+		})
+	}
+
+	t.Run("InsertGenerated", func(t *testing.T) {
+		user := &Users{Name: sql.NullString{String: "Moe", Valid: true}, Email: "moe@stooges.com"}
+		_, err := db.Insert("users", user)
+		require.NoError(t, err)
+		require.NotZero(t, user.ID)
+		group := UserGroups{UserID: user.ID, GroupName: "stooges", Admin: true,
+			Dues: sql.NullString{String: "10.5", Valid: true}}
+		_, err = db.Insert("user_groups", group)
+		require.NoError(t, err)
+
+		users := []Users{}
+		err = db.Select(&users, "SELECT ** FROM users")
+		require.NoError(t, err)
+		require.Equal(t, 1, len(users))
+		require.Equal(t, user.Email, users[0].Email)
+		groups := []UserGroups{}
+		err = db.Select(&groups, "SELECT ** FROM user_groups")
+		require.NoError(t, err)
+		require.Equal(t, []UserGroups{group}, groups)
+	})
+
+	t.Run("MissingTable", func(t *testing.T) {
+		err := generate(ioutil.Discard, db, config{pkg: "models", tables: []string{"groups"}})
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,414 @@
+// Command sequel-querygen generates typed Go functions from SQL files containing named queries.
+//
+// eg.
+//
+// 		sequel-querygen -schema schema.sql -package queries -o queries/queries.go queries/*.sql
+//
+// Each query must be annotated with its name and kind, as parsed by sequel.ParseQueries:
+//
+// 		-- name: FindUsersByGroup :many
+// 		SELECT id, name FROM users WHERE group_id = ?
+//
+// Queries are executed against an in-memory SQLite database created from the schema DDL, to derive
+// their result columns. Parameter names and types are inferred from the column each placeholder is
+// compared to, eg. "group_id = ?", falling back to interface{}.
+//
+// "**" and "t.**" are derived as "*" and "t.*", and are expanded by Sequel from the fields of the
+// generated row struct, so they must make up the whole of the result columns.
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3" // imported for side-effects
+	"github.com/pkg/errors"
+
+	"github.com/alecthomas/sequel"
+	"github.com/alecthomas/sequel/internal/codegen"
+	"github.com/alecthomas/sequel/internal/syntax"
+)
+
+var (
+	// Column compared to a placeholder, eg. "u.group_id = ?" or "id IN (?".
+	comparisonRegex = regexp.MustCompile(`(?i)([\w.]+)\s*(?:=|<>|!=|<=|>=|<|>|\bLIKE|\bIN)\s*\(?\s*$`)
+	// Clauses taking an integer placeholder.
+	limitRegex = regexp.MustCompile(`(?i)\b(LIMIT|OFFSET)\s*$`)
+	// INSERT with an explicit column list, eg. "INSERT INTO users (name, email) VALUES (?, ?)".
+	insertRegex = regexp.MustCompile(`(?is)^\s*INSERT\s+INTO\s+\S+\s*\(([^)]*)\)\s*VALUES\s*\(([^)]*)\)\s*$`)
+)
+
+func main() {
+	schema := flag.String("schema", "", "File containing the SQLite DDL of the schema.")
+	pkg := flag.String("package", "queries", "Package name of the generated code.")
+	output := flag.String("o", "", "File to write generated code to (default stdout).")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: sequel-querygen [flags] <file.sql> ...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *schema == "" || flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ddl, err := ioutil.ReadFile(*schema)
+	if err != nil {
+		fatalf("%s", err)
+	}
+	queries := []sequel.NamedQuery{}
+	for _, path := range flag.Args() {
+		parsed, err := parseFile(path)
+		if err != nil {
+			fatalf("%s", err)
+		}
+		queries = append(queries, parsed...)
+	}
+
+	w := io.Writer(os.Stdout)
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fatalf("%s", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := generate(w, string(ddl), *pkg, queries); err != nil {
+		fatalf("%s", err)
+	}
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "sequel-querygen: error: "+format+"\n", args...)
+	os.Exit(1)
+}
+
+func parseFile(path string) ([]sequel.NamedQuery, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return sequel.ParseQueries(f, path)
+}
+
+// A Go field derived from a placeholder or result column.
+type goField struct {
+	name   string
+	t      string
+	column string
+}
+
+type generator struct {
+	db      *sequel.DB
+	columns map[string][]sequel.Column
+	imports map[string]bool
+	body    *bytes.Buffer
+}
+
+// Generate functions for queries, deriving types from the schema.
+func generate(w io.Writer, schema, pkg string, queries []sequel.NamedQuery) error {
+	db, err := sequel.Open("sqlite3", ":memory:")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	// Each connection to an in-memory database has its own schema.
+	db.DB.SetMaxOpenConns(1)
+	if _, err := db.DB.Exec(schema); err != nil {
+		return errors.Wrap(err, "failed to create schema")
+	}
+	g := &generator{
+		db:      db,
+		columns: map[string][]sequel.Column{},
+		imports: map[string]bool{"github.com/alecthomas/sequel": true},
+		body:    &bytes.Buffer{},
+	}
+	tables, err := db.Tables()
+	if err != nil {
+		return err
+	}
+	for _, table := range tables {
+		columns, err := db.Columns(table)
+		if err != nil {
+			return err
+		}
+		for _, column := range columns {
+			g.columns[column.Name] = append(g.columns[column.Name], column)
+		}
+	}
+	for _, query := range queries {
+		if err := g.generateQuery(query); err != nil {
+			return errors.Wrapf(err, "%s:%d: %s", query.File, query.Line, query.Name)
+		}
+	}
+	return codegen.Write(w, "sequel-querygen", pkg, g.imports, g.body.Bytes())
+}
+
+func (g *generator) generateQuery(query sequel.NamedQuery) error {
+	star, wildcard, err := starWildcards(query.SQL)
+	if err != nil {
+		return err
+	}
+	if wildcard && query.Kind == sequel.QueryExec {
+		return errors.New("\"**\" is only supported by queries returning rows, as it is expanded from the row struct")
+	}
+	params := g.params(query.SQL, splitPlaceholders(query.SQL))
+	var rows []goField
+	if query.Kind != sequel.QueryExec {
+		rows, err = g.resultColumns(star, len(params))
+		if err != nil {
+			return err
+		}
+		if wildcard {
+			if err := g.checkWildcard(query.SQL, rows, len(params)); err != nil {
+				return err
+			}
+		}
+	}
+
+	name := codegen.GoName(query.Name)
+	constName := strings.ToLower(name[:1]) + name[1:] + "Query"
+	fmt.Fprintf(g.body, "\nconst %s = %s\n", constName, quote(query.SQL))
+
+	args := []string{"db sequel.Interface"}
+	callArgs := []string{constName}
+	if len(params) > 0 {
+		fmt.Fprintf(g.body, "\n// %sParams are the parameters of %s.\n", name, name)
+		g.writeStruct(name+"Params", params, false)
+		args = append(args, "params "+name+"Params")
+		for _, param := range params {
+			callArgs = append(callArgs, "params."+param.name)
+		}
+	}
+	if query.Kind != sequel.QueryExec {
+		fmt.Fprintf(g.body, "\n// %sRow is a row returned by %s.\n", name, name)
+		g.writeStruct(name+"Row", rows, true)
+	}
+
+	fmt.Fprintf(g.body, "\n// %s executes the named query %s from %s.\n", name, query.Name, query.File)
+	signature := fmt.Sprintf("func %s(%s)", name, strings.Join(args, ", "))
+	call := strings.Join(callArgs, ", ")
+	switch query.Kind {
+	case sequel.QueryOne:
+		fmt.Fprintf(g.body, "%s (%sRow, error) {\n", signature, name)
+		fmt.Fprintf(g.body, "\trow := %sRow{}\n", name)
+		fmt.Fprintf(g.body, "\terr := db.SelectOne(&row, %s)\n", call)
+		fmt.Fprintf(g.body, "\treturn row, err\n}\n")
+	case sequel.QueryMany:
+		fmt.Fprintf(g.body, "%s ([]%sRow, error) {\n", signature, name)
+		fmt.Fprintf(g.body, "\trows := []%sRow{}\n", name)
+		fmt.Fprintf(g.body, "\terr := db.Select(&rows, %s)\n", call)
+		fmt.Fprintf(g.body, "\treturn rows, err\n}\n")
+	case sequel.QueryExec:
+		g.imports["database/sql"] = true
+		fmt.Fprintf(g.body, "%s (sql.Result, error) {\n", signature)
+		fmt.Fprintf(g.body, "\treturn db.Exec(%s)\n}\n", call)
+	}
+	return nil
+}
+
+func (g *generator) writeStruct(name string, fields []goField, tagged bool) {
+	fmt.Fprintf(g.body, "type %s struct {\n", name)
+	for _, field := range fields {
+		if tagged {
+			fmt.Fprintf(g.body, "\t%s %s `db:\"%s\"`\n", field.name, field.t, field.column)
+		} else {
+			fmt.Fprintf(g.body, "\t%s %s\n", field.name, field.t)
+		}
+	}
+	fmt.Fprintf(g.body, "}\n")
+}
+
+// Infer a name and type for each placeholder from the SQL preceding it.
+func (g *generator) params(query string, fragments []string) []goField {
+	if len(fragments) < 2 {
+		return nil
+	}
+	out := make([]goField, len(fragments)-1)
+	var insertColumns []string
+	if groups := insertRegex.FindStringSubmatch(query); groups != nil {
+		values := strings.Split(groups[2], ",")
+		columns := strings.Split(groups[1], ",")
+		if len(values) == len(columns) && len(columns) == len(out) {
+			insertColumns = columns
+		}
+	}
+	seen := map[string]int{}
+	for i := range out {
+		column, slice := "", false
+		switch {
+		case insertColumns != nil:
+			column = strings.Trim(strings.TrimSpace(insertColumns[i]), "`\"")
+		case limitRegex.MatchString(fragments[i]):
+			column = strings.ToLower(limitRegex.FindStringSubmatch(fragments[i])[1])
+		default:
+			if groups := comparisonRegex.FindStringSubmatch(fragments[i]); groups != nil {
+				column = groups[1][strings.LastIndex(groups[1], ".")+1:]
+				slice = strings.HasSuffix(strings.ToUpper(strings.TrimRight(fragments[i], " \t\n(")), "IN")
+			}
+		}
+		t := "interface{}"
+		switch {
+		case column == "limit" || column == "offset":
+			t = "int64"
+		case column != "":
+			t = g.columnType(column)
+		default:
+			column = fmt.Sprintf("arg%d", i+1)
+		}
+		if slice {
+			t = "[]" + t
+		}
+		name := codegen.GoName(column)
+		seen[name]++
+		if seen[name] > 1 {
+			name += strconv.Itoa(seen[name])
+		}
+		if strings.HasPrefix(t, "time.") || strings.HasPrefix(t, "[]time.") {
+			g.imports["time"] = true
+		}
+		out[i] = goField{name: name, t: t}
+	}
+	return out
+}
+
+// Non-nullable Go type of a column, if it is unambiguous.
+func (g *generator) columnType(name string) string {
+	out := ""
+	for _, column := range g.columns[name] {
+		t := codegen.ScalarType(column.Type)
+		if out != "" && out != t {
+			return "interface{}"
+		}
+		out = t
+	}
+	if out == "" {
+		return "interface{}"
+	}
+	return out
+}
+
+// NULL for each parameter of a query.
+func nullArgs(params int) []interface{} {
+	args := make([]interface{}, params)
+	for i := range args {
+		args[i] = sql.NullString{}
+	}
+	return args
+}
+
+// Derive fields for the result columns of query by executing it, with NULL for each parameter,
+// in a transaction that is rolled back.
+func (g *generator) resultColumns(query string, params int) ([]goField, error) {
+	expanded, args, err := g.db.Expand(query, true, nullArgs(params)...)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := g.db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() // nolint: errcheck
+	rows, err := tx.Query(expanded, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to execute query against schema")
+	}
+	defer rows.Close()
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]goField, len(types))
+	for i, ct := range types {
+		column := sequel.Column{Name: ct.Name(), Type: ct.DatabaseTypeName(), Nullable: true}
+		// Nullability is only known for columns that match a single table column.
+		if candidates := g.columns[ct.Name()]; len(candidates) == 1 {
+			column.Nullable = candidates[0].Nullable
+		}
+		t, pkg := codegen.GoType(column, false)
+		if pkg != "" {
+			g.imports[pkg] = true
+		}
+		if strings.HasPrefix(t, "sql.") {
+			g.imports["database/sql"] = true
+		}
+		out[i] = goField{name: codegen.GoName(ct.Name()), t: t, column: ct.Name()}
+	}
+	return out, nil
+}
+
+// Check that Sequel's expansion of "**" from the fields of the row struct selects exactly the
+// result columns, by selecting into an equivalent struct.
+func (g *generator) checkWildcard(query string, fields []goField, params int) error {
+	structFields := make([]reflect.StructField, len(fields))
+	seen := map[string]bool{}
+	for i, field := range fields {
+		if seen[field.column] {
+			return errors.Errorf("\"**\" can't be expanded to the duplicate result column %q", field.column)
+		}
+		seen[field.column] = true
+		structFields[i] = reflect.StructField{
+			Name: fmt.Sprintf("F%d", i),
+			Type: reflect.TypeOf(sql.NullString{}),
+			Tag:  reflect.StructTag(fmt.Sprintf(`db:"%s"`, field.column)),
+		}
+	}
+	rows := reflect.New(reflect.SliceOf(reflect.StructOf(structFields)))
+	err := g.db.Select(rows.Interface(), query, nullArgs(params)...)
+	return errors.Wrap(err, "\"**\" expands to every field of the row struct, so must make up the whole of the result columns")
+}
+
+// Split query into the SQL fragments between "?" placeholders, tokenized as by Sequel.
+func splitPlaceholders(query string) []string {
+	fragments := []string{}
+	w := &strings.Builder{}
+	for _, match := range syntax.Lexer.FindAllStringSubmatch(query, -1) {
+		if match[1] == "?" {
+			fragments = append(fragments, w.String())
+			w.Reset()
+			continue
+		}
+		w.WriteString(match[0])
+	}
+	return append(fragments, w.String())
+}
+
+// Replace "**" and "t.**" wildcards in query with "*" and "t.*", returning true if there were any.
+func starWildcards(query string) (string, bool, error) {
+	w := &strings.Builder{}
+	wildcard := false
+	for _, match := range syntax.Lexer.FindAllStringSubmatch(query, -1) {
+		switch {
+		case match[3] == "**" && match[4] != "":
+			return "", false, errors.Errorf("\"**(%s)\" is not supported by generated queries", match[4])
+		case match[3] == "**" && match[2] != "":
+			wildcard = true
+			w.WriteString(match[2] + ".*")
+		case match[3] == "**":
+			wildcard = true
+			w.WriteString("*")
+		default:
+			w.WriteString(match[0])
+		}
+	}
+	return w.String(), wildcard, nil
+}
+
+// Quote SQL as a raw string literal if possible.
+func quote(s string) string {
+	if strings.Contains(s, "`") {
+		return strconv.Quote(s)
+	}
+	return "`" + s + "`"
+}
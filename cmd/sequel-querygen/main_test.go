@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/alecthomas/sequel"
+)
+
+const fixtureSchema = `
+CREATE TABLE users (
+	id INTEGER PRIMARY KEY,
+	group_id INTEGER NOT NULL,
+	name VARCHAR(255),
+	email TEXT NOT NULL,
+	created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+`
+
+const fixtureQueries = `
+-- Queries for users.
+
+-- name: FindUsersByGroup :many
+SELECT id, name, email FROM users WHERE group_id = ? ORDER BY name LIMIT ?;
+
+-- name: GetUserByEmail :one
+SELECT u.id, u.created FROM users u WHERE u.email = ?;
+
+-- name: FindUsersByID :many
+SELECT email FROM users WHERE id IN (?);
+
+-- name: CreateUser :exec
+INSERT INTO users (group_id, name, email) VALUES (?, ?, ?);
+`
+
+func TestGenerate(t *testing.T) {
+	queries, err := sequel.ParseQueries(strings.NewReader(fixtureQueries), "users.sql")
+	require.NoError(t, err)
+	w := &bytes.Buffer{}
+	err = generate(w, fixtureSchema, "queries", queries)
+	require.NoError(t, err)
+	require.Equal(t, `// Code generated by sequel-querygen. DO NOT EDIT.
+
+package queries
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/alecthomas/sequel"
+)
+
+const findUsersByGroupQuery = `+"`SELECT id, name, email FROM users WHERE group_id = ? ORDER BY name LIMIT ?`"+`
+
+// FindUsersByGroupParams are the parameters of FindUsersByGroup.
+type FindUsersByGroupParams struct {
+	GroupID int64
+	Limit   int64
+}
+
+// FindUsersByGroupRow is a row returned by FindUsersByGroup.
+type FindUsersByGroupRow struct {
+	ID    int64          `+"`db:\"id\"`"+`
+	Name  sql.NullString `+"`db:\"name\"`"+`
+	Email string         `+"`db:\"email\"`"+`
+}
+
+// FindUsersByGroup executes the named query FindUsersByGroup from users.sql.
+func FindUsersByGroup(db sequel.Interface, params FindUsersByGroupParams) ([]FindUsersByGroupRow, error) {
+	rows := []FindUsersByGroupRow{}
+	err := db.Select(&rows, findUsersByGroupQuery, params.GroupID, params.Limit)
+	return rows, err
+}
+
+const getUserByEmailQuery = `+"`SELECT u.id, u.created FROM users u WHERE u.email = ?`"+`
+
+// GetUserByEmailParams are the parameters of GetUserByEmail.
+type GetUserByEmailParams struct {
+	Email string
+}
+
+// GetUserByEmailRow is a row returned by GetUserByEmail.
+type GetUserByEmailRow struct {
+	ID      int64     `+"`db:\"id\"`"+`
+	Created time.Time `+"`db:\"created\"`"+`
+}
+
+// GetUserByEmail executes the named query GetUserByEmail from users.sql.
+func GetUserByEmail(db sequel.Interface, params GetUserByEmailParams) (GetUserByEmailRow, error) {
+	row := GetUserByEmailRow{}
+	err := db.SelectOne(&row, getUserByEmailQuery, params.Email)
+	return row, err
+}
+
+const findUsersByIDQuery = `+"`SELECT email FROM users WHERE id IN (?)`"+`
+
+// FindUsersByIDParams are the parameters of FindUsersByID.
+type FindUsersByIDParams struct {
+	ID []int64
+}
+
+// FindUsersByIDRow is a row returned by FindUsersByID.
+type FindUsersByIDRow struct {
+	Email string `+"`db:\"email\"`"+`
+}
+
+// FindUsersByID executes the named query FindUsersByID from users.sql.
+func FindUsersByID(db sequel.Interface, params FindUsersByIDParams) ([]FindUsersByIDRow, error) {
+	rows := []FindUsersByIDRow{}
+	err := db.Select(&rows, findUsersByIDQuery, params.ID)
+	return rows, err
+}
+
+const createUserQuery = `+"`INSERT INTO users (group_id, name, email) VALUES (?, ?, ?)`"+`
+
+// CreateUserParams are the parameters of CreateUser.
+type CreateUserParams struct {
+	GroupID int64
+	Name    string
+	Email   string
+}
+
+// CreateUser executes the named query CreateUser from users.sql.
+func CreateUser(db sequel.Interface, params CreateUserParams) (sql.Result, error) {
+	return db.Exec(createUserQuery, params.GroupID, params.Name, params.Email)
+}
+`, w.String())
+}
+
+func TestGenerateErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		queries string
+		err     string
+	}{
+		{name: "WildcardWithOtherColumns",
+			queries: "-- name: CountUsers :many\nSELECT **, COUNT(*) AS n FROM users GROUP BY id",
+			err:     `"**" expands to every field of the row struct`},
+		{name: "WildcardExec",
+			queries: "-- name: CopyUsers :exec\nINSERT INTO users (**) SELECT * FROM users",
+			err:     `"**" is only supported by queries returning rows`},
+		{name: "AliasedWildcard",
+			queries: "-- name: AllUsers :many\nSELECT **(u) FROM users u",
+			err:     `"**(u)" is not supported`},
+		{name: "UnknownColumn",
+			queries: "-- name: Ages :many\nSELECT age FROM users",
+			err:     "no such column: age"},
+	}
+	for _, test := range tests {
+		// nolint: scopelint
+		t.Run(test.name, func(t *testing.T) {
+			queries, err := sequel.ParseQueries(strings.NewReader(test.queries), "test.sql")
+			require.NoError(t, err)
+			err = generate(&bytes.Buffer{}, fixtureSchema, "queries", queries)
+			require.Error(t, err)
+			require.Contains(t, err.Error(), test.err)
+		})
+	}
+}
+
+func TestGenerateWildcard(t *testing.T) {
+	queries, err := sequel.ParseQueries(strings.NewReader(
+		"-- name: FindUsers :many\nSELECT u.** FROM users u WHERE u.group_id = ?"), "users.sql")
+	require.NoError(t, err)
+	w := &bytes.Buffer{}
+	err = generate(w, fixtureSchema, "queries", queries)
+	require.NoError(t, err)
+	require.Contains(t, w.String(), `type FindUsersRow struct {
+	ID      int64          `+"`db:\"id\"`"+`
+	GroupID int64          `+"`db:\"group_id\"`"+`
+	Name    sql.NullString `+"`db:\"name\"`"+`
+	Email   string         `+"`db:\"email\"`"+`
+	Created time.Time      `+"`db:\"created\"`"+`
+}`)
+	require.Contains(t, w.String(), `err := db.Select(&rows, findUsersQuery, params.GroupID)`)
+}
+
+func TestSplitPlaceholders(t *testing.T) {
+	fragments := splitPlaceholders("SELECT '?', \"a?\", `b?` FROM t WHERE a = ? AND b IN (?)")
+	require.Equal(t, []string{"SELECT '?', \"a?\", `b?` FROM t WHERE a = ", " AND b IN (", ")"}, fragments)
+}
+
+func TestStarWildcards(t *testing.T) {
+	star, wildcard, err := starWildcards("SELECT u.**, '**' FROM users u WHERE id = ?")
+	require.NoError(t, err)
+	require.True(t, wildcard)
+	require.Equal(t, "SELECT u.*, '**' FROM users u WHERE id = ?", star)
+}
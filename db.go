@@ -1,10 +1,13 @@
 package sequel
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"math/rand"
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -25,16 +28,105 @@ type Interface interface {
 	SelectString(query string, args ...interface{}) (value string, err error)
 }
 
+// Querier extends Interface with methods added since Interface was introduced, which are kept out of
+// it so as not to break existing implementations of Interface.
+//
+// See DB or Transaction for documentation.
+type Querier interface {
+	Interface
+	SelectTuples(slice interface{}, query string, args ...interface{}) error
+	SelectMap(ref interface{}, query string, args ...interface{}) error
+	Mapping(mode MappingMode) Querier
+	SelectNamed(slice interface{}, name string, args ...interface{}) error
+	SelectOneNamed(ref interface{}, name string, args ...interface{}) error
+	ExecNamed(name string, args ...interface{}) (sql.Result, error)
+}
+
+// Transactor is implemented by DB and Transaction, allowing code to begin a unit of work regardless of
+// whether it is already running in a transaction.
+//
+// See DB or Transaction for documentation.
+type Transactor interface {
+	Querier
+	Begin() (*Transaction, error)
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*Transaction, error)
+	RunInTx(ctx context.Context, opts *sql.TxOptions, fn func(tx *Transaction) error) error
+}
+
+// ErrRollbackOnly is returned by Commit when a joined nested transaction was rolled back.
+var ErrRollbackOnly = errors.New("transaction was rolled back by a joined nested transaction")
+
+// Nesting controls how transactions begun within a transaction behave.
+type Nesting int
+
+const (
+	// NestSavepoint creates a savepoint that is released on Commit, or rolled back to on Rollback.
+	NestSavepoint Nesting = iota
+	// NestJoin joins the existing transaction. Commit is a no-op, while Rollback marks the outermost
+	// transaction as rollback-only, causing its Commit to roll back and return ErrRollbackOnly.
+	NestJoin
+)
+
+// MappingMode controls how strictly result columns must match struct fields when selecting.
+//
+// Modes may be combined, eg. IgnoreUnmappedColumns|AllowMissingFields.
+type MappingMode int
+
+const (
+	// MappingStrict requires every result column to map to a field, and every field to be mapped
+	// by a result column. This is the default.
+	MappingStrict MappingMode = 0
+	// IgnoreUnmappedColumns discards result columns that do not map to a field, eg. columns
+	// added to a table before the code selecting from it with "*" is deployed.
+	IgnoreUnmappedColumns MappingMode = 1
+	// AllowMissingFields allows fields that are not mapped by a result column. These fields are
+	// left unchanged.
+	AllowMissingFields MappingMode = 2
+)
+
 // Option for modifying the behaviour of Sequel.
 type Option func(db *DB)
 
+// WithMappingMode sets how strictly result columns must match struct fields. Defaults to MappingStrict.
+//
+// The mode can also be overridden per call with Mapping().
+func WithMappingMode(mode MappingMode) Option {
+	return func(db *DB) { db.mode = mode }
+}
+
+// WithNesting sets how transactions begun within a transaction behave. Defaults to NestSavepoint.
+func WithNesting(nesting Nesting) Option {
+	return func(db *DB) { db.nesting = nesting }
+}
+
+// WithTxRetries sets the maximum number of attempts RunInTx will make, and the initial backoff between
+// attempts. The backoff doubles after each failed attempt.
+//
+// The default is 3 attempts with an initial backoff of 10ms. At least one attempt is always made, and
+// a negative backoff is treated as zero.
+func WithTxRetries(attempts int, backoff time.Duration) Option {
+	return func(db *DB) {
+		if attempts < 1 {
+			attempts = 1
+		}
+		if backoff < 0 {
+			backoff = 0
+		}
+		db.txAttempts = attempts
+		db.txBackoff = backoff
+	}
+}
+
 // DB over an existing sql.DB.
 type DB struct {
 	DB *sql.DB
 	queryable
+	txAttempts int
+	txBackoff  time.Duration
+	nesting    Nesting
 }
 
-var _ Interface = &DB{}
+var _ Transactor = &DB{}
 
 // Open a database connection.
 func Open(driver, dsn string, options ...Option) (*DB, error) {
@@ -70,7 +162,10 @@ func NewFromDriver(driver string, db *sql.DB, options ...Option) (*DB, error) {
 		queryable: queryable{
 			db:      db,
 			dialect: dialect,
+			mapper:  newMapper(),
 		},
+		txAttempts: 3,
+		txBackoff:  time.Millisecond * 10,
 	}
 	for _, opt := range options {
 		opt(sqldb)
@@ -85,32 +180,241 @@ func (q *DB) Close() error {
 
 // Begin a new transaction.
 func (q *DB) Begin() (*Transaction, error) {
-	tx, err := q.DB.Begin()
+	return q.BeginTx(context.Background(), nil)
+}
+
+// BeginTx begins a new transaction with the given isolation level and read-only mode.
+//
+// Where the driver ignores sql.TxOptions the dialect issues equivalent statements itself. For SQLite,
+// LevelSerializable begins an IMMEDIATE transaction, LevelLinearizable begins an EXCLUSIVE transaction,
+// and ReadOnly enables "PRAGMA query_only" for the duration of the transaction. In this case
+// Transaction.Tx will be nil, so use the methods of Transaction rather than Tx.
+func (q *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Transaction, error) {
+	tx, err := q.dialect.Begin(ctx, q.DB, opts)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to open transaction")
+		return nil, errors.Wrap(classifyError(q.dialect, err), "failed to open transaction")
 	}
+	sqltx, _ := tx.(*sql.Tx)
 	return &Transaction{
-		Tx:        tx,
-		queryable: queryable{db: tx, dialect: q.dialect},
+		Tx:        sqltx,
+		queryable: queryable{db: tx, dialect: q.dialect, mapper: q.mapper, mode: q.mode, queries: q.queries},
+		tx:        tx,
+		nesting:   q.nesting,
 	}, nil
 }
 
+// RunInTx runs fn in a new transaction, which is committed if fn returns nil and rolled back otherwise.
+//
+// If the transaction fails with an error that the dialect classifies as retryable (see IsRetryable),
+// the transaction, including fn, is retried with exponential backoff. fn must therefore be safe to
+// call more than once. Non-retryable errors are returned immediately. See WithTxRetries.
+func (q *DB) RunInTx(ctx context.Context, opts *sql.TxOptions, fn func(tx *Transaction) error) error {
+	backoff := q.txBackoff
+	for attempt := 1; ; attempt++ {
+		tx, err := q.BeginTx(ctx, opts)
+		if err == nil {
+			err = runInTx(tx, fn)
+		}
+		if err == nil || !IsRetryable(err) || attempt >= q.txAttempts {
+			return err
+		}
+		// Jitter between 50% and 100% of the backoff.
+		delay := backoff / 2
+		if delay > 0 {
+			delay += time.Duration(rand.Int63n(int64(delay) + 1)) // nolint: gosec
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Wrapf(err, "%s while retrying transaction", ctx.Err())
+		case <-time.After(delay):
+		}
+		backoff *= 2
+	}
+}
+
+func runInTx(tx *Transaction, fn func(tx *Transaction) error) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+		tx.CommitOrRollbackOnError(&err)
+	}()
+	return fn(tx)
+}
+
 // A Transaction wraps an underlying sql.Tx.
 type Transaction struct {
+	// Tx is the driver transaction, or nil if the transaction was started by the dialect rather than
+	// the driver. See DB.BeginTx.
+	//
+	// Deprecated: use the methods of Transaction, which work for all transactions.
 	Tx *sql.Tx
 	queryable
+	tx      txOps
+	nesting Nesting
+	// Set for nested transactions.
+	parent    *Transaction
+	savepoint string
+	joined    bool
+	done      bool
+	// Set on the outermost transaction.
+	savepoints   int // Count of savepoints created, used to generate unique names.
+	rollbackOnly bool
+	onCommit     []func()
+	onRollback   []func()
+}
+
+var _ Transactor = &Transaction{}
+
+// Begin a nested transaction.
+//
+// By default nested transactions are implemented with savepoints, which are named automatically.
+// Commit on the nested transaction releases the savepoint, while Rollback rolls back to it.
+// See WithNesting.
+func (t *Transaction) Begin() (*Transaction, error) {
+	if t.done {
+		return nil, sql.ErrTxDone
+	}
+	child := &Transaction{
+		Tx:        t.Tx,
+		queryable: t.queryable,
+		tx:        t.tx,
+		nesting:   t.nesting,
+		parent:    t,
+	}
+	if t.nesting == NestJoin {
+		child.joined = true
+		return child, nil
+	}
+	root := t.root()
+	root.savepoints++
+	child.savepoint = fmt.Sprintf("sequel_savepoint_%d", root.savepoints)
+	if _, err := t.tx.Exec("SAVEPOINT " + child.savepoint); err != nil {
+		return nil, errors.Wrap(classifyError(t.dialect, err), "failed to create savepoint")
+	}
+	return child, nil
+}
+
+// BeginTx begins a nested transaction. See Begin.
+//
+// The isolation level and read-only mode of the outermost transaction apply, so opts is ignored.
+func (t *Transaction) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Transaction, error) {
+	return t.Begin()
+}
+
+// RunInTx runs fn in a nested transaction, which is committed if fn returns nil and rolled back otherwise.
+//
+// Unlike DB.RunInTx, failures are not retried, as retryable errors abort the outermost transaction.
+func (t *Transaction) RunInTx(ctx context.Context, opts *sql.TxOptions, fn func(tx *Transaction) error) error {
+	tx, err := t.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+	return runInTx(tx, fn)
 }
 
-var _ Interface = &Transaction{}
+func (t *Transaction) root() *Transaction {
+	root := t
+	for root.parent != nil {
+		root = root.parent
+	}
+	return root
+}
+
+// OnCommit registers a function to be called after the transaction has been committed.
+//
+// Functions registered on a nested transaction are deferred until the outermost transaction commits.
+func (t *Transaction) OnCommit(fn func()) {
+	t.onCommit = append(t.onCommit, fn)
+}
+
+// OnRollback registers a function to be called after the transaction has been rolled back.
+//
+// Functions registered on a nested transaction are called when its savepoint is rolled back, or
+// when the outermost transaction is rolled back.
+func (t *Transaction) OnRollback(fn func()) {
+	t.onRollback = append(t.onRollback, fn)
+}
 
 // Commit transaction.
 func (t *Transaction) Commit() error {
-	return t.Tx.Commit()
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+	if t.joined {
+		t.promoteCallbacks()
+		return nil
+	}
+	if t.savepoint != "" {
+		err := t.execSavepoint("RELEASE SAVEPOINT " + t.savepoint)
+		t.promoteCallbacks()
+		return err
+	}
+	if t.rollbackOnly {
+		err := t.tx.Rollback()
+		runCallbacks(t.onRollback)
+		if err != nil {
+			return classifyError(t.dialect, err)
+		}
+		return ErrRollbackOnly
+	}
+	err := t.tx.Commit()
+	if err != nil {
+		runCallbacks(t.onRollback)
+		return classifyError(t.dialect, err)
+	}
+	runCallbacks(t.onCommit)
+	return nil
 }
 
 // Rollback transaction.
 func (t *Transaction) Rollback() error {
-	return t.Tx.Rollback()
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+	if t.joined {
+		t.promoteCallbacks()
+		t.root().rollbackOnly = true
+		return nil
+	}
+	if t.savepoint != "" {
+		err := t.execSavepoint("ROLLBACK TO SAVEPOINT "+t.savepoint, "RELEASE SAVEPOINT "+t.savepoint)
+		if err != nil {
+			// The outcome will be decided by the outer transaction.
+			t.promoteCallbacks()
+			return err
+		}
+		runCallbacks(t.onRollback)
+		return nil
+	}
+	err := t.tx.Rollback()
+	runCallbacks(t.onRollback)
+	return classifyError(t.dialect, err)
+}
+
+func (t *Transaction) execSavepoint(stmts ...string) error {
+	for _, stmt := range stmts {
+		if _, err := t.tx.Exec(stmt); err != nil {
+			return classifyError(t.dialect, err)
+		}
+	}
+	return nil
+}
+
+// Pass callbacks up to the parent transaction.
+func (t *Transaction) promoteCallbacks() {
+	t.parent.onCommit = append(t.parent.onCommit, t.onCommit...)
+	t.parent.onRollback = append(t.parent.onRollback, t.onRollback...)
+	t.onCommit, t.onRollback = nil, nil
+}
+
+func runCallbacks(callbacks []func()) {
+	for _, fn := range callbacks {
+		fn()
+	}
 }
 
 // CommitOrRollbackOnError is a convenience method that can be used on a named error return value to rollback if an
@@ -131,8 +435,8 @@ func (t *Transaction) Rollback() error {
 // 		}
 func (t *Transaction) CommitOrRollbackOnError(err *error) {
 	if *err == nil {
-		*err = t.Tx.Commit()
-	} else if rberr := t.Tx.Rollback(); rberr != nil {
+		*err = t.Commit()
+	} else if rberr := t.Rollback(); rberr != nil {
 		*err = rberr
 	}
 }
@@ -144,9 +448,28 @@ type sqlOps interface {
 	QueryRow(query string, args ...interface{}) *sql.Row
 }
 
+// Operations on an open transaction.
+type txOps interface {
+	sqlOps
+	Commit() error
+	Rollback() error
+}
+
 type queryable struct {
 	db      sqlOps
 	dialect dialect
+	mapper  *mapper
+	mode    MappingMode
+	queries *Queries
+}
+
+// Mapping returns a Querier that selects with the given MappingMode, eg.
+//
+// 		err := db.Mapping(sequel.IgnoreUnmappedColumns).Select(&users, "SELECT * FROM users")
+func (q *queryable) Mapping(mode MappingMode) Querier {
+	out := *q
+	out.mode = mode
+	return &out
 }
 
 // Expand query and args using Sequel's expansion rules.
@@ -158,19 +481,27 @@ type queryable struct {
 //
 // Returns the expanded query and args, or an error.
 func (q *queryable) Expand(query string, withManaged bool, args ...interface{}) (string, []interface{}, error) {
-	return expand(q.dialect, withManaged, nil, query, args)
+	m, err := q.mapper.forQuery(q.db, q.dialect, query)
+	if err != nil {
+		return "", nil, err
+	}
+	return expand(q.dialect, m, withManaged, nil, query, args)
 }
 
 // Exec an SQL statement and ignore the result.
 func (q *queryable) Exec(query string, args ...interface{}) (res sql.Result, err error) {
-	query, args, err = expand(q.dialect, true, nil, query, args)
+	m, err := q.mapper.forQuery(q.db, q.dialect, query)
+	if err != nil {
+		return nil, err
+	}
+	query, args, err = expand(q.dialect, m, true, nil, query, args)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to expand query %q", query)
 	}
 	// TODO: Can we parse column names out of the statement, and reflect the same out of args, to be more type safe?
 	result, err := q.db.Exec(query, args...)
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to execute %q", query)
+		return nil, errors.Wrapf(classifyError(q.dialect, err), "failed to execute %q", query)
 	}
 	return result, nil
 }
@@ -189,6 +520,10 @@ func (q *queryable) Update(query string, args ...interface{}) (affected int64, e
 // It accepts a list of rows ("Insert(table, rows)"), or a vararg sequence
 // ("Insert(table, row0, row1, row2)"). Column names are reflected from the first row.
 //
+// Rows may also be of type map[string]interface{}, for columns that are not known at compile time.
+// Columns are then the sorted union of the keys of all rows, and columns missing from a row are set
+// to their DEFAULT value (or NULL on SQLite).
+//
 // Any fields marked with "managed" will not be set during insertion.
 //
 // Will return IDs of generated rows if applicable, or nil if not supported.
@@ -205,12 +540,16 @@ func (q *queryable) Insert(table string, rows ...interface{}) ([]int64, error) {
 			if v.Len() == 0 {
 				return nil, nil
 			}
-		case reflect.Struct:
+		case reflect.Struct, reflect.Map:
 		default:
-			return nil, errors.Errorf("unexpected a slice or struct but got %T", rows)
+			return nil, errors.Errorf("expected a slice, struct or map but got %T", rows[0])
 		}
 	}
-	return q.dialect.Insert(q.db, table, rows)
+	m, err := q.mapper.forTable(q.db, q.dialect, table)
+	if err != nil {
+		return nil, err
+	}
+	return q.dialect.Insert(q.db, m, table, rows)
 }
 
 // Upsert rows.
@@ -218,21 +557,47 @@ func (q *queryable) Insert(table string, rows ...interface{}) ([]int64, error) {
 // Existing rows will be updated and new rows will be inserted.
 //
 // "keys" must be the list of column names that will trigger a unique constraint violation if an UPDATE is to occur.
+//
+// As with Insert, rows may also be of type map[string]interface{}, in which case every row must have
+// the same keys, and only those columns are inserted or updated.
 func (q *queryable) Upsert(table string, keys []string, rows ...interface{}) (sql.Result, error) {
 	if len(rows) == 0 {
 		return nil, errors.Errorf("no rows to update")
 	}
+	if maps, ok := asMapRows(rows); ok {
+		query, args, err := maps.upsert(q.dialect, table, keys)
+		if err != nil {
+			return nil, err
+		}
+		result, err := q.db.Exec(query, args...)
+		if err != nil {
+			return nil, errors.Wrapf(classifyError(q.dialect, err), "failed to execute %q", query)
+		}
+		return result, nil
+	}
+	m, err := q.mapper.forTable(q.db, q.dialect, table)
+	if err != nil {
+		return nil, err
+	}
 	arg, _, t, _ := typeForMutationRows(rows...)
-	builder, err := makeRowBuilderForType(t)
+	builder, err := m.makeRowBuilderForType(t)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to map type %s", t)
 	}
-	query := q.dialect.Upsert(table, keys, builder)
-	query, args, err := expand(q.dialect, true, builder, query, []interface{}{arg})
+	builder = m.restrict(builder)
+	if err := builder.checkMutable(); err != nil {
+		return nil, err
+	}
+	query := q.dialect.Upsert(table, keys, builder, "?")
+	query, args, err := expand(q.dialect, m, true, builder, query, []interface{}{arg})
 	if err != nil {
 		return nil, err
 	}
-	return q.db.Exec(query, args...)
+	result, err := q.db.Exec(query, args...)
+	if err != nil {
+		return nil, errors.Wrapf(classifyError(q.dialect, err), "failed to execute %q", query)
+	}
+	return result, nil
 }
 
 func typeForMutationRows(rows ...interface{}) (arg interface{}, count int, t reflect.Type, slice reflect.Value) {
@@ -257,12 +622,26 @@ func typeForMutationRows(rows ...interface{}) (arg interface{}, count int, t ref
 // Select issues a query, and accumulates the returned rows into slice.
 //
 // The shape and names of the query must match the shape and field names of the slice elements.
+//
+// "slice" may also be a pointer to a slice of Row or map[string]interface{}, for queries whose
+// columns are not known at compile time, or a pointer to a slice of scalars such as int64, strings
+// or sql.Scanner implementations, for queries returning a single column.
 func (q *queryable) Select(slice interface{}, query string, args ...interface{}) (err error) {
-	builder, err := makeRowBuilderForSlice(slice)
+	if isDynamicSlice(slice) {
+		return q.selectDynamic(slice, query, args...)
+	}
+	if isScalarSlice(slice) {
+		return q.selectScalars(slice, query, args...)
+	}
+	m, err := q.mapper.forQuery(q.db, q.dialect, query)
+	if err != nil {
+		return err
+	}
+	builder, err := m.makeRowBuilderForSlice(slice)
 	if err != nil {
 		return errors.Wrapf(err, "failed to map slice %T", slice)
 	}
-	rows, columns, mapping, err := q.prepareSelect(builder, query, args...)
+	rows, columns, mapping, err := q.prepareSelect(m, builder, query, args...)
 	if err != nil {
 		return errors.Wrapf(err, "failed to prepare select %q", query)
 	}
@@ -274,10 +653,10 @@ func (q *queryable) Select(slice interface{}, query string, args ...interface{})
 	out := reflect.ValueOf(slice).Elem()
 	addrElem := out.Type().Elem().Kind() == reflect.Ptr
 	for rows.Next() {
-		el, values := builder.build(columns)
-		err = rows.Scan(values...)
+		el := reflect.New(builder.t).Elem()
+		err = builder.scan(m, rows, el, columns)
 		if err != nil {
-			return errors.Wrap(err, mapping)
+			return errors.Wrap(classifyError(q.dialect, err), mapping)
 		}
 		if addrElem {
 			el = el.Addr()
@@ -285,78 +664,104 @@ func (q *queryable) Select(slice interface{}, query string, args ...interface{})
 		out = reflect.Append(out, el)
 	}
 	reflect.ValueOf(slice).Elem().Set(out)
-	return rows.Err()
+	return classifyError(q.dialect, rows.Err())
 }
 
 // SelectOne issues a query and selects a single row into ref.
 //
 // Will return sql.ErrNoRows if no rows are returned.
 func (q *queryable) SelectOne(ref interface{}, query string, args ...interface{}) error {
-	builder, err := makeRowBuilder(ref)
+	m, err := q.mapper.forQuery(q.db, q.dialect, query)
+	if err != nil {
+		return err
+	}
+	builder, err := m.makeRowBuilder(ref)
 	if err != nil {
 		return errors.Wrapf(err, "failed to map type %T", ref)
 	}
-	rows, columns, mapping, err := q.prepareSelect(builder, query, args...)
+	rows, columns, mapping, err := q.prepareSelect(m, builder, query, args...)
 	if err != nil {
 		return errors.Wrapf(err, "failed to prepare select %q", query)
 	}
 	defer rows.Close()
 	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			return classifyError(q.dialect, err)
+		}
 		return sql.ErrNoRows
 	}
-	values := builder.fill(ref, columns)
-	err = rows.Scan(values...)
+	err = builder.scan(m, rows, reflect.ValueOf(ref).Elem(), columns)
 	if err != nil {
-		return errors.Wrap(err, mapping)
+		return errors.Wrap(classifyError(q.dialect, err), mapping)
 	}
 	if rows.Next() {
 		return errors.Errorf("more than one row returned from %q", query)
 	}
-	return rows.Err()
+	return classifyError(q.dialect, rows.Err())
 }
 
-func (q *queryable) prepareSelect(builder *builder, query string, args ...interface{}) (rows *sql.Rows, columns []string, mapping string, err error) {
-	query, args, err = expand(q.dialect, true, builder, query, args)
-	if err != nil {
-		return nil, nil, "", errors.Wrapf(err, "failed to expand query %q", query)
-	}
-	rows, err = q.db.Query(query, args...)
-	if err != nil {
-		return nil, nil, "", errors.Wrapf(err, "%q (mapping to fields %s)", query, strings.Join(builder.fields, ", "))
-	}
-	columns, err = rows.Columns()
+func (q *queryable) prepareSelect(m *mapper, builder *builder, query string, args ...interface{}) (rows *sql.Rows, columns []string, mapping string, err error) {
+	rows, columns, err = q.query(m, builder, query, args...)
 	if err != nil {
-		_ = rows.Close()
-		return nil, nil, "", errors.Wrap(err, "failed to retrieve columns")
+		return nil, nil, "", err
 	}
 	mapping = fmt.Sprintf("(%s) -> (%s)", strings.Join(columns, ","), strings.Join(builder.fields, ","))
 
 	// Strict checks.
-	fieldMap := map[string]bool{}
-	for _, field := range builder.fields {
-		fieldMap[field] = true
-	}
+	selected := map[string]bool{}
 	for _, column := range columns {
-		if !fieldMap[column] {
+		if _, ok := builder.fieldMap[column]; ok {
+			selected[column] = true
+		} else if q.mode&IgnoreUnmappedColumns == 0 {
 			_ = rows.Close()
 			return nil, nil, "", errors.Errorf("no field in (%s) maps to result column %q", strings.Join(builder.fields, ", "), column)
 		}
 	}
-	if len(columns) != len(builder.fields) {
-		_ = rows.Close()
-		return nil, nil, "", errors.Errorf("invalid mapping %s", mapping)
+	if q.mode&AllowMissingFields == 0 {
+		for _, name := range builder.fields {
+			// Fields without a column in the target table are omitted by "**". See WithSchemaIntrospection.
+			if !selected[name] && m.hasColumn(builder.fieldMap[name]) {
+				_ = rows.Close()
+				return nil, nil, "", errors.Errorf("invalid mapping %s", mapping)
+			}
+		}
 	}
 	return rows, columns, mapping, nil
 }
 
+// Expand and execute a query, returning the rows and their column names.
+func (q *queryable) query(m *mapper, builder *builder, query string, args ...interface{}) (*sql.Rows, []string, error) {
+	query, args, err := expand(q.dialect, m, true, builder, query, args)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to expand query %q", query)
+	}
+	rows, err := q.db.Query(query, args...)
+	if err != nil {
+		if builder == nil {
+			return nil, nil, errors.Wrapf(classifyError(q.dialect, err), "%q", query)
+		}
+		return nil, nil, errors.Wrapf(classifyError(q.dialect, err), "%q (mapping to fields %s)", query, strings.Join(builder.fields, ", "))
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		_ = rows.Close()
+		return nil, nil, errors.Wrap(err, "failed to retrieve columns")
+	}
+	return rows, columns, nil
+}
+
 // SelectScalar selects a single column row into value.
 func (q *queryable) SelectScalar(value interface{}, query string, args ...interface{}) (err error) {
-	query, args, err = expand(q.dialect, true, nil, query, args)
+	m, err := q.mapper.forQuery(q.db, q.dialect, query)
+	if err != nil {
+		return err
+	}
+	query, args, err = expand(q.dialect, m, true, nil, query, args)
 	if err != nil {
 		return errors.Wrapf(err, "failed to expand query %q", query)
 	}
 	row := q.db.QueryRow(query, args...)
-	return row.Scan(value)
+	return classifyError(q.dialect, row.Scan(value))
 }
 
 // SelectInt selects a single column row into an integer and returns it.
@@ -2,9 +2,19 @@
 package sequel_test
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3" // imported for side-effects
 	"github.com/stretchr/testify/require"
@@ -29,6 +39,14 @@ type invalidUser struct {
 	Mail string
 }
 
+type account struct {
+	ID     int `db:"id,pk,managed"`
+	UserID int
+	Name   string
+}
+
+func (account) TableName() string { return "accounts" }
+
 var (
 	larry = user{Name: str("Larry"), Email: "larry@stooges.com", ID: 1}
 	moe   = user{Email: "moe@stooges.com", ID: 2}
@@ -108,6 +126,686 @@ func TestDBSelect(t *testing.T) {
 	}
 }
 
+func TestSelectNested(t *testing.T) {
+	db := databaseFixture(t)
+	defer db.Close()
+	insertFixtures(t, db)
+	insertAccountFixtures(t, db)
+
+	type userAccount struct {
+		User    user    `db:"u"`
+		Account account `db:"acct,prefix"`
+	}
+	actual := []userAccount{}
+	err := db.Select(&actual, `
+		SELECT ** FROM users u
+		INNER JOIN accounts ON accounts.user_id = u.id
+		ORDER BY accounts.id
+	`)
+	require.NoError(t, err)
+	require.Equal(t, []userAccount{
+		{User: larry, Account: account{ID: 1, UserID: 1, Name: "Larry's"}},
+		{User: curly, Account: account{ID: 2, UserID: 3, Name: "Curly's"}},
+	}, actual)
+}
+
+func TestSelectNullableNested(t *testing.T) {
+	db := databaseFixture(t)
+	defer db.Close()
+	insertFixtures(t, db)
+	insertAccountFixtures(t, db)
+
+	type userAccount struct {
+		User    user     `db:"u"`
+		Account *account `db:"acct,prefix"`
+	}
+	actual := []userAccount{}
+	err := db.Select(&actual, `
+		SELECT ** FROM users u
+		LEFT JOIN accounts ON accounts.user_id = u.id
+		ORDER BY u.id
+	`)
+	require.NoError(t, err)
+	require.Equal(t, []userAccount{
+		{User: larry, Account: &account{ID: 1, UserID: 1, Name: "Larry's"}},
+		{User: moe},
+		{User: curly, Account: &account{ID: 2, UserID: 3, Name: "Curly's"}},
+	}, actual)
+
+	one := userAccount{}
+	err = db.SelectOne(&one, `SELECT ** FROM users u LEFT JOIN accounts ON accounts.user_id = u.id WHERE u.id = ?`, 2)
+	require.NoError(t, err)
+	require.Equal(t, userAccount{User: moe}, one)
+}
+
+func TestMutateNested(t *testing.T) {
+	db := databaseFixture(t)
+	defer db.Close()
+
+	type accountWithUser struct {
+		Name string `db:"name"`
+		User user   `db:"user,prefix"`
+	}
+	row := accountWithUser{Name: "Larry's", User: larry}
+	_, err := db.Insert("accounts", row)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "nested struct")
+	_, err = db.Upsert("accounts", []string{"name"}, row)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "nested struct")
+	_, err = db.Exec(`INSERT INTO accounts (**) VALUES ?`, row)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "nested struct")
+}
+
+func TestSelectTuples(t *testing.T) {
+	db := databaseFixture(t)
+	defer db.Close()
+	insertFixtures(t, db)
+	insertAccountFixtures(t, db)
+
+	type userAccount struct {
+		User    user     `db:"u"`
+		Account *account `db:"a"`
+	}
+	expected := []userAccount{
+		{User: larry, Account: &account{ID: 1, UserID: 1, Name: "Larry's"}},
+		{User: moe},
+		{User: curly, Account: &account{ID: 2, UserID: 3, Name: "Curly's"}},
+	}
+	tests := []struct {
+		name     string
+		query    string
+		expected interface{}
+		err      string
+	}{
+		{name: "Sequential",
+			query:    `SELECT u.*, a.* FROM users u LEFT JOIN accounts a ON a.user_id = u.id ORDER BY u.id`,
+			expected: expected},
+		{name: "Wildcard",
+			query:    `SELECT ** FROM users u LEFT JOIN accounts ON accounts.user_id = u.id ORDER BY u.id`,
+			expected: expected},
+		{name: "QualifiedWildcards",
+			query:    `SELECT u.**, a.** FROM users u LEFT JOIN accounts a ON a.user_id = u.id ORDER BY u.id`,
+			expected: expected},
+		{name: "Qualified",
+			query: `SELECT a.id AS "a.id", a.name AS "a.name", u.*, a.user_id AS "accounts.user_id"
+					FROM users u LEFT JOIN accounts a ON a.user_id = u.id ORDER BY u.id`,
+			expected: expected},
+		{name: "MissingFields",
+			query: `SELECT u.*, a.id, a.name FROM users u LEFT JOIN accounts a ON a.user_id = u.id`,
+			err:   "invalid mapping"},
+		{name: "UnmappedColumn",
+			query: `SELECT u.*, a.*, 1 AS extra FROM users u LEFT JOIN accounts a ON a.user_id = u.id`,
+			err:   `no field in (u.id, u.name, u.email, a.id, a.user_id, a.name) maps to result column "extra"`},
+	}
+	for _, test := range tests {
+		// nolint: scopelint
+		t.Run(test.name, func(t *testing.T) {
+			actual := []userAccount{}
+			err := db.SelectTuples(&actual, test.query)
+			if test.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), test.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, actual)
+		})
+	}
+
+	err := db.SelectTuples(&[]struct{ U user }{}, `SELECT ** FROM users u`)
+	require.NoError(t, err)
+	err = db.SelectTuples(&[]struct{ ID int }{}, `SELECT id FROM users`)
+	require.EqualError(t, err, "failed to map slice *[]struct { ID int }: field ID: tuple fields must be structs or pointers to structs, not int")
+}
+
+func TestSelectDynamic(t *testing.T) {
+	db := databaseFixture(t)
+	defer db.Close()
+	_, err := db.Exec(`
+	CREATE TABLE dynamic (
+		id INTEGER PRIMARY KEY,
+		score REAL,
+		label VARCHAR(32),
+		data BLOB,
+		enabled BOOLEAN,
+		amount DECIMAL(10, 2),
+		created DATETIME
+	)
+	`)
+	require.NoError(t, err)
+	created := time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)
+	_, err = db.Exec(`INSERT INTO dynamic VALUES (1, 1.5, 'one', x'0102', 1, '10.50', '2019-01-02 03:04:05'), (2, NULL, NULL, NULL, NULL, NULL, NULL)`)
+	require.NoError(t, err)
+
+	columns := []string{"id", "score", "label", "data", "enabled", "amount", "created", "count"}
+	rows := []sequel.Row{}
+	err = db.Select(&rows, `SELECT *, 2 AS count FROM dynamic ORDER BY id`)
+	require.NoError(t, err)
+	require.Equal(t, []sequel.Row{
+		{Columns: columns, Values: []interface{}{int64(1), 1.5, "one", []byte{1, 2}, true, "10.5", created, int64(2)}},
+		{Columns: columns, Values: []interface{}{int64(2), nil, nil, nil, nil, nil, nil, int64(2)}},
+	}, rows)
+	value, ok := rows[0].Get("label")
+	require.True(t, ok)
+	require.Equal(t, "one", value)
+	_, ok = rows[0].Get("missing")
+	require.False(t, ok)
+
+	maps := []map[string]interface{}{}
+	err = db.Select(&maps, `SELECT id, label FROM dynamic WHERE id = ?`, 1)
+	require.NoError(t, err)
+	require.Equal(t, []map[string]interface{}{{"id": int64(1), "label": "one"}}, maps)
+
+	err = db.Select(&maps, `SELECT ** FROM dynamic`)
+	require.Error(t, err)
+}
+
+func TestSelectScalars(t *testing.T) {
+	db := databaseFixture(t)
+	defer db.Close()
+	insertFixtures(t, db)
+
+	ids := []int64{}
+	err := db.Select(&ids, `SELECT id FROM users ORDER BY id`)
+	require.NoError(t, err)
+	require.Equal(t, []int64{1, 2, 3}, ids)
+
+	names := []sql.NullString{}
+	err = db.Select(&names, `SELECT name FROM users ORDER BY id`)
+	require.NoError(t, err)
+	require.Equal(t, []sql.NullString{str("Larry"), {}, str("Curly")}, names)
+
+	pointers := []*string{}
+	err = db.Select(&pointers, `SELECT name FROM users WHERE id = ?`, 2)
+	require.NoError(t, err)
+	require.Equal(t, []*string{nil}, pointers)
+
+	err = db.Select(&ids, `SELECT id, name FROM users`)
+	require.EqualError(t, err, "can only select a single column into *[]int64, not (id, name)")
+}
+
+func TestSelectMap(t *testing.T) {
+	db := databaseFixture(t)
+	defer db.Close()
+	insertFixtures(t, db)
+	insertAccountFixtures(t, db)
+
+	var emails map[string]int
+	err := db.SelectMap(&emails, `SELECT email, id FROM users`)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"larry@stooges.com": 1, "moe@stooges.com": 2, "curly@stooges.com": 3}, emails)
+
+	users := map[int]user{}
+	err = db.SelectMap(&users, `SELECT email, name, id FROM users`)
+	require.NoError(t, err)
+	require.Equal(t, map[int]user{1: larry, 2: moe, 3: curly}, users)
+
+	byEmail := map[string]*userData{}
+	err = db.SelectMap(&byEmail, `SELECT email, name FROM users WHERE id = ?`, 1)
+	require.NoError(t, err)
+	require.Equal(t, map[string]*userData{"larry@stooges.com": {Name: str("Larry"), Email: "larry@stooges.com"}}, byEmail)
+
+	counts := map[int64]int64{}
+	err = db.SelectMap(&counts, `SELECT user_id, COUNT(*) FROM accounts GROUP BY user_id`)
+	require.NoError(t, err)
+	require.Equal(t, map[int64]int64{1: 1, 3: 1}, counts)
+
+	err = db.SelectMap(&map[int]int{}, `SELECT 1, id FROM users`)
+	require.EqualError(t, err, "duplicate key 1")
+	err = db.SelectMap(&counts, `SELECT user_id FROM accounts`)
+	require.EqualError(t, err, "can only select key and value columns into map[int64]int64, not (user_id)")
+	err = db.SelectMap(&map[bool]userData{}, `SELECT ** FROM users`)
+	require.EqualError(t, err, "can't key map[bool]sequel_test.userData by field name of type sql.NullString")
+	err = db.SelectMap(emails, `SELECT email, id FROM users`)
+	require.EqualError(t, err, "expected a pointer to a map but got map[string]int")
+}
+
+type countingJSONEncoder struct{ marshalled, unmarshalled int }
+
+func (c *countingJSONEncoder) Marshal(v interface{}) ([]byte, error) {
+	c.marshalled++
+	return json.Marshal(v)
+}
+
+func (c *countingJSONEncoder) Unmarshal(data []byte, v interface{}) error {
+	c.unmarshalled++
+	return json.Unmarshal(data, v)
+}
+
+func TestJSONFields(t *testing.T) {
+	type document struct {
+		ID       int               `db:",pk,managed"`
+		Tags     []string          `db:",json"`
+		Attrs    map[string]string `db:",json"`
+		Metadata *struct {
+			Author string `json:"author"`
+		} `db:",json"`
+	}
+	encoder := &countingJSONEncoder{}
+	db := databaseFixture(t, sequel.WithJSONEncoder(encoder))
+	defer db.Close()
+	_, err := db.Exec(`CREATE TABLE documents (id INTEGER PRIMARY KEY, tags TEXT, attrs TEXT, metadata TEXT)`)
+	require.NoError(t, err)
+
+	docs := []*document{
+		{Tags: []string{"a", "b"}, Attrs: map[string]string{"k": "v"}},
+		{Tags: []string{}},
+	}
+	_, err = db.Insert("documents", docs)
+	require.NoError(t, err)
+	require.Equal(t, 3, encoder.marshalled)
+
+	raw, err := db.SelectString(`SELECT tags FROM documents WHERE id = 1`)
+	require.NoError(t, err)
+	require.Equal(t, `["a","b"]`, raw)
+	nulls, err := db.SelectInt(`SELECT COUNT(*) FROM documents WHERE metadata IS NULL`)
+	require.NoError(t, err)
+	require.Equal(t, 2, nulls)
+
+	actual := []*document{}
+	err = db.Select(&actual, `SELECT ** FROM documents ORDER BY id`)
+	require.NoError(t, err)
+	require.Equal(t, docs, actual)
+	require.Equal(t, 3, encoder.unmarshalled)
+}
+
+func TestByteArrayFields(t *testing.T) {
+	type blob struct {
+		ID   [16]byte `db:",uuid"`
+		Hash [32]byte
+	}
+	db := databaseFixture(t)
+	defer db.Close()
+	_, err := db.Exec(`CREATE TABLE blobs (id TEXT PRIMARY KEY, hash BLOB NOT NULL)`)
+	require.NoError(t, err)
+
+	expected := []blob{
+		{ID: [16]byte{0x6b, 0xa7, 0xb8, 0x10, 0x9d, 0xad, 0x11, 0xd1, 0x80, 0xb4, 0x00, 0xc0, 0x4f, 0xd4, 0x30, 0xc8}},
+		{ID: [16]byte{1}, Hash: [32]byte{1, 2, 3}},
+	}
+	_, err = db.Insert("blobs", expected)
+	require.NoError(t, err)
+
+	id, err := db.SelectString(`SELECT id FROM blobs WHERE hash = ?`, [32]byte{})
+	require.NoError(t, err)
+	require.Equal(t, "6ba7b810-9dad-11d1-80b4-00c04fd430c8", id)
+
+	actual := []blob{}
+	err = db.Select(&actual, `SELECT ** FROM blobs ORDER BY id DESC`)
+	require.NoError(t, err)
+	require.Equal(t, expected, actual)
+}
+
+func TestCodecFields(t *testing.T) {
+	sequel.RegisterCodec(reflect.TypeOf(net.IP{}),
+		func(v interface{}) (driver.Value, error) { return v.(net.IP).String(), nil },
+		func(src interface{}, dest interface{}) error {
+			ip := net.ParseIP(fmt.Sprintf("%s", src))
+			if ip == nil {
+				return fmt.Errorf("invalid IP %q", src)
+			}
+			*dest.(*net.IP) = ip
+			return nil
+		})
+	sequel.RegisterCodec(reflect.TypeOf(url.URL{}),
+		func(v interface{}) (driver.Value, error) { u := v.(url.URL); return u.String(), nil },
+		func(src interface{}, dest interface{}) error {
+			u, err := url.Parse(fmt.Sprintf("%s", src))
+			if err != nil {
+				return err
+			}
+			*dest.(*url.URL) = *u
+			return nil
+		})
+
+	type host struct {
+		IP       net.IP
+		Homepage *url.URL
+	}
+	db := databaseFixture(t)
+	defer db.Close()
+	_, err := db.Exec(`CREATE TABLE hosts (ip TEXT NOT NULL, homepage TEXT)`)
+	require.NoError(t, err)
+
+	expected := []host{
+		{IP: net.ParseIP("10.0.0.1"), Homepage: &url.URL{Scheme: "https", Host: "example.com", Path: "/"}},
+		{IP: net.ParseIP("::1")},
+	}
+	_, err = db.Insert("hosts", expected)
+	require.NoError(t, err)
+
+	homepage, err := db.SelectString(`SELECT homepage FROM hosts WHERE ip = ?`, net.ParseIP("10.0.0.1"))
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com/", homepage)
+
+	actual := []host{}
+	err = db.Select(&actual, `SELECT ** FROM hosts ORDER BY ip`)
+	require.NoError(t, err)
+	require.Equal(t, expected, actual)
+}
+
+func TestNameMapper(t *testing.T) {
+	type event struct {
+		EventID   int64
+		UserEmail string
+	}
+	tests := []struct {
+		name    string
+		mapper  sequel.NameMapper
+		columns string
+	}{
+		{name: "SnakeCase", mapper: sequel.SnakeCaseMapper, columns: "event_id, user_email"},
+		{name: "CamelCase", mapper: sequel.CamelCaseMapper, columns: "eventId, userEmail"},
+		{name: "Identity", mapper: sequel.IdentityMapper, columns: "EventID, UserEmail"},
+		{name: "UpperSnakeCase",
+			mapper:  func(name string) string { return strings.ToUpper(sequel.SnakeCaseMapper(name)) },
+			columns: "EVENT_ID, USER_EMAIL"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := databaseFixture(t, sequel.WithNameMapper(test.mapper))
+			defer db.Close()
+			_, err := db.Exec(`CREATE TABLE events (` + strings.Replace(test.columns, ",", " INTEGER,", 1) + ` TEXT)`)
+			require.NoError(t, err)
+
+			expected := []event{{EventID: 1, UserEmail: "moe@stooges.com"}}
+			_, err = db.Insert("events", expected)
+			require.NoError(t, err)
+
+			query, _, err := db.Expand(`SELECT ** FROM events`, true, []event{})
+			require.NoError(t, err)
+			require.Equal(t, "SELECT `"+strings.Replace(test.columns, ", ", "`, `", -1)+"` FROM events", query)
+
+			actual := []event{}
+			err = db.Select(&actual, `SELECT ** FROM events`)
+			require.NoError(t, err)
+			require.Equal(t, expected, actual)
+		})
+	}
+}
+
+func TestMappingMode(t *testing.T) {
+	type userWithAge struct {
+		ID    int
+		Email string
+		Age   int
+	}
+	tests := []struct {
+		name     string
+		mode     sequel.MappingMode
+		dest     interface{}
+		expected interface{}
+		err      bool
+	}{
+		{name: "StrictUnmappedColumn", mode: sequel.MappingStrict, dest: &[]userData{}, err: true},
+		{name: "StrictMissingField", mode: sequel.MappingStrict, dest: &[]userWithAge{}, err: true},
+		{name: "IgnoreUnmappedColumns",
+			mode:     sequel.IgnoreUnmappedColumns,
+			dest:     &[]userData{},
+			expected: &[]userData{{Name: str("Larry"), Email: "larry@stooges.com"}}},
+		{name: "IgnoreUnmappedColumnsMissingField", mode: sequel.IgnoreUnmappedColumns, dest: &[]userWithAge{}, err: true},
+		{name: "AllowMissingFieldsUnmappedColumn", mode: sequel.AllowMissingFields, dest: &[]userData{}, err: true},
+		{name: "Lenient",
+			mode:     sequel.IgnoreUnmappedColumns | sequel.AllowMissingFields,
+			dest:     &[]userWithAge{},
+			expected: &[]userWithAge{{ID: 1, Email: "larry@stooges.com"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := databaseFixture(t)
+			defer db.Close()
+			insertFixtures(t, db)
+			err := db.Mapping(test.mode).Select(test.dest, `SELECT * FROM users WHERE id = 1`)
+			if test.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, test.dest)
+		})
+	}
+
+	t.Run("Option", func(t *testing.T) {
+		db := databaseFixture(t, sequel.WithMappingMode(sequel.IgnoreUnmappedColumns))
+		defer db.Close()
+		insertFixtures(t, db)
+		tx, err := db.Begin()
+		require.NoError(t, err)
+		defer tx.Rollback() // nolint: errcheck
+		actual := userData{}
+		err = tx.SelectOne(&actual, `SELECT * FROM users WHERE id = 1`)
+		require.NoError(t, err)
+		require.Equal(t, userData{Name: str("Larry"), Email: "larry@stooges.com"}, actual)
+	})
+}
+
+func TestSchemaIntrospection(t *testing.T) {
+	// Nickname has been added to the code but not yet to the schema.
+	type userV2 struct {
+		ID       int `db:"id,pk,managed"`
+		Name     sql.NullString
+		Email    string
+		Nickname string
+	}
+	warnings := []string{}
+	db := databaseFixture(t, sequel.WithSchemaIntrospection(func(table, field string) {
+		warnings = append(warnings, table+"."+field)
+	}))
+	defer db.Close()
+	insertFixtures(t, db)
+
+	ids, err := db.Insert("users", &userV2{Name: str("Shemp"), Email: "shemp@stooges.com", Nickname: "shemp"})
+	require.NoError(t, err)
+	require.Equal(t, []int64{4}, ids)
+
+	_, err = db.Upsert("users", []string{"id"}, userV2{ID: 1, Name: str("Larry"), Email: "larry@stooges.org"})
+	require.NoError(t, err)
+
+	_, err = db.Exec(`INSERT INTO users (**) VALUES ?`, userV2{ID: 5, Email: "joe@stooges.com"})
+	require.NoError(t, err)
+
+	actual := []userV2{}
+	err = db.Select(&actual, `SELECT ** FROM users WHERE id IN (1, 4) ORDER BY id`)
+	require.NoError(t, err)
+	require.Equal(t, []userV2{
+		{ID: 1, Name: str("Larry"), Email: "larry@stooges.org"},
+		{ID: 4, Name: str("Shemp"), Email: "shemp@stooges.com"},
+	}, actual)
+
+	count, err := db.SelectInt(`SELECT COUNT(*) FROM users`)
+	require.NoError(t, err)
+	require.Equal(t, 5, count)
+
+	// Warnings are only issued once per type and table.
+	require.Equal(t, []string{"users.nickname"}, warnings)
+
+	actual = []userV2{}
+	err = db.Select(&actual, `SELECT ** FROM main.users WHERE id = 1`)
+	require.NoError(t, err)
+	require.Equal(t, []userV2{{ID: 1, Name: str("Larry"), Email: "larry@stooges.org"}}, actual)
+	require.Equal(t, []string{"users.nickname", "main.users.nickname"}, warnings)
+}
+
+func TestSchemaIntrospectionComputedColumns(t *testing.T) {
+	warnings := []string{}
+	db := databaseFixture(t, sequel.WithSchemaIntrospection(func(table, field string) {
+		warnings = append(warnings, table+"."+field)
+	}))
+	defer db.Close()
+	insertFixtures(t, db)
+
+	counts := []struct{ N int }{}
+	err := db.Select(&counts, `SELECT COUNT(*) AS n FROM users`)
+	require.NoError(t, err)
+	require.Equal(t, []struct{ N int }{{3}}, counts)
+
+	type nameAndDomain struct {
+		Name   string
+		Domain string
+	}
+	actual := nameAndDomain{}
+	err = db.SelectOne(&actual, `SELECT name, substr(email, instr(email, '@') + 1) AS domain FROM users WHERE id = 1`)
+	require.NoError(t, err)
+	require.Equal(t, nameAndDomain{Name: "Larry", Domain: "stooges.com"}, actual)
+	require.Empty(t, warnings)
+}
+
+func TestSchemaIntrospectionMissingTable(t *testing.T) {
+	type userV2 struct {
+		ID       int `db:"id,pk,managed"`
+		Email    string
+		Nickname string
+	}
+	db := databaseFixture(t, sequel.WithSchemaIntrospection(nil))
+	defer db.Close()
+
+	// Tables that do not exist yet are not restricted, and not cached.
+	_, err := db.Insert("people", &userV2{Email: "moe@stooges.com", Nickname: "moe"})
+	require.Error(t, err)
+	_, err = db.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, email TEXT NOT NULL)`)
+	require.NoError(t, err)
+	_, err = db.Insert("people", &userV2{Email: "moe@stooges.com", Nickname: "moe"})
+	require.NoError(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	type unmanagedUser struct {
+		ID    int `db:"id,pk"`
+		Name  sql.NullString
+		Email string
+	}
+	type nonNullableUser struct {
+		ID    int `db:"id,pk,managed"`
+		Name  string
+		Email string
+	}
+	type mistypedUser struct {
+		ID    string `db:"id,pk,managed"`
+		Name  sql.NullString
+		Email string
+	}
+	tests := []struct {
+		name  string
+		row   interface{}
+		table string
+		err   string
+	}{
+		{name: "Valid", row: user{}, table: "users"},
+		{name: "ValidPointer", row: &userData{}, table: "users"},
+		{name: "MissingTable", row: user{}, table: "people", err: `table "people" does not exist`},
+		{name: "MissingColumn", row: invalidUser{}, table: "users", err: "field mail has no column"},
+		{name: "NonNullableField", row: nonNullableUser{}, table: "users",
+			err: "column name is nullable but field name is of non-nullable type string"},
+		{name: "UnmanagedAutoIncrement", row: unmanagedUser{}, table: "users",
+			err: "column id has a database assigned value but field id is not tagged managed"},
+		{name: "IncompatibleType", row: mistypedUser{}, table: "users",
+			err: "column id of type INTEGER is incompatible with field id of type string"},
+		{name: "UnmanagedDefault", row: userData{}, table: "defaults",
+			err: "column email has a database assigned value but field email is not tagged managed"},
+	}
+	db := databaseFixture(t)
+	defer db.Close()
+	_, err := db.Exec(`CREATE TABLE defaults (name TEXT, email TEXT NOT NULL DEFAULT '')`)
+	require.NoError(t, err)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := db.Validate(test.row, test.table)
+			if test.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), test.err)
+			}
+		})
+	}
+}
+
+func TestParseQueries(t *testing.T) {
+	tests := []struct {
+		name     string
+		sql      string
+		expected []sequel.NamedQuery
+		err      string
+	}{
+		{name: "Queries",
+			sql: "-- Users.\n\n-- name: FindUsers :many\nSELECT **\nFROM users;\n\n--name:DeleteUser :exec\nDELETE FROM users WHERE id = ?\n",
+			expected: []sequel.NamedQuery{
+				{Name: "FindUsers", Kind: sequel.QueryMany, SQL: "SELECT **\nFROM users", File: "users.sql", Line: 3},
+				{Name: "DeleteUser", Kind: sequel.QueryExec, SQL: "DELETE FROM users WHERE id = ?", File: "users.sql", Line: 7},
+			}},
+		{name: "SQLBeforeName", sql: "SELECT 1\n-- name: One :one\nSELECT 1", err: "users.sql:1:"},
+		{name: "MissingKind", sql: "-- name: One\nSELECT 1", err: "must be of kind"},
+		{name: "InvalidKind", sql: "-- name: One :single\nSELECT 1", err: "must be of kind"},
+		{name: "Duplicate", sql: "-- name: One :one\nSELECT 1\n-- name: One :one\nSELECT 1", err: "users.sql:3: duplicate query One"},
+		{name: "Empty", sql: "-- name: One :one\n;\n", err: "query One is empty"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			queries, err := sequel.ParseQueries(strings.NewReader(test.sql), "users.sql")
+			if test.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), test.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, queries)
+		})
+	}
+}
+
+func TestLoadQueries(t *testing.T) {
+	fsys := fstest.MapFS{
+		"queries/users.sql": {Data: []byte(`
+-- name: FindUsersByEmail :many
+SELECT ** FROM users WHERE email IN (?) ORDER BY id;
+
+-- name: GetUser :one
+SELECT ** FROM users WHERE id = ?;
+`)},
+		"queries/updates.sql": {Data: []byte(`
+-- name: RenameUser :exec
+UPDATE users SET name = ? WHERE id = ?;
+`)},
+		"invalid/quote.sql": {Data: []byte("-- name: Invalid :one\nSELECT * FROM users WHERE name = 'larry")},
+		"invalid/dup.sql":   {Data: []byte("-- name: GetUser :one\nSELECT 1")},
+	}
+	queries, err := sequel.LoadQueries(fsys, "queries/*.sql")
+	require.NoError(t, err)
+	require.Equal(t, []string{"FindUsersByEmail", "GetUser", "RenameUser"}, queries.Names())
+
+	db := databaseFixture(t, sequel.WithQueries(queries))
+	defer db.Close()
+	insertFixtures(t, db)
+
+	_, err = db.ExecNamed("RenameUser", "Moe", 2)
+	require.NoError(t, err)
+
+	actual := []user{}
+	err = db.SelectNamed(&actual, "FindUsersByEmail", []string{"larry@stooges.com", "moe@stooges.com"})
+	require.NoError(t, err)
+	require.Equal(t, []user{larry, {ID: 2, Name: str("Moe"), Email: "moe@stooges.com"}}, actual)
+
+	one := user{}
+	err = db.SelectOneNamed(&one, "GetUser", 3)
+	require.NoError(t, err)
+	require.Equal(t, curly, one)
+	err = db.SelectOneNamed(&one, "GetUser", 4)
+	require.Equal(t, sql.ErrNoRows, err)
+
+	err = db.SelectNamed(&actual, "Unknown")
+	require.EqualError(t, err, "unknown named query Unknown")
+
+	_, err = sequel.LoadQueries(fsys, "invalid/quote.sql")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid/quote.sql:1: query Invalid: unexpected \"'\"")
+	_, err = sequel.LoadQueries(fsys, "*/*.sql")
+	require.Error(t, err)
+	_, err = sequel.LoadQueries(fsys, "missing/*.sql")
+	require.Error(t, err)
+}
+
 func TestSelectOne(t *testing.T) {
 	db := databaseFixture(t)
 	defer db.Close()
@@ -179,6 +877,271 @@ func TestCommitOrRollbackOnError(t *testing.T) {
 	}
 }
 
+func TestBeginTxCancel(t *testing.T) {
+	db := databaseFixture(t)
+	defer db.Close()
+	db.DB.SetMaxOpenConns(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	require.NoError(t, err)
+	_, err = tx.Exec(`INSERT INTO users (name, email) VALUES (?, ?)`, "Larry", "larry@stooges.com")
+	require.NoError(t, err)
+	cancel()
+
+	// The only connection must be released for this to succeed.
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	conn, err := db.DB.Conn(ctx)
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+
+	require.Equal(t, sql.ErrTxDone, tx.Commit())
+	count, err := db.SelectInt(`SELECT COUNT(*) FROM users`)
+	require.NoError(t, err)
+	require.Equal(t, 0, count)
+}
+
+func TestBeginTx(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     *sql.TxOptions
+		driverTx bool
+		err      string
+	}{
+		{name: "Default", driverTx: true},
+		{name: "Serializable", opts: &sql.TxOptions{Isolation: sql.LevelSerializable}},
+		{name: "Linearizable", opts: &sql.TxOptions{Isolation: sql.LevelLinearizable}},
+		{name: "ReadOnly", opts: &sql.TxOptions{ReadOnly: true}, err: "readonly"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := databaseFixture(t)
+			defer db.Close()
+
+			tx, err := db.BeginTx(context.Background(), test.opts)
+			require.NoError(t, err)
+			require.Equal(t, test.driverTx, tx.Tx != nil) // nolint: staticcheck
+			_, err = tx.Exec(`INSERT INTO users (name, email) VALUES (?, ?)`, "Larry", "larry@stooges.com")
+			if test.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), test.err)
+				require.NoError(t, tx.Rollback())
+			} else {
+				require.NoError(t, err)
+				require.NoError(t, tx.Commit())
+			}
+			require.Error(t, tx.Commit())
+
+			// Connection state must be restored after the transaction completes.
+			_, err = db.Exec(`INSERT INTO users (name, email) VALUES (?, ?)`, "Moe", "moe@stooges.com")
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestNestedTransaction(t *testing.T) {
+	db := databaseFixture(t)
+	defer db.Close()
+
+	insert := func(tx *sequel.Transaction, email string) {
+		_, err := tx.Exec(`INSERT INTO users (email) VALUES (?)`, email)
+		require.NoError(t, err)
+	}
+
+	tx, err := db.Begin()
+	require.NoError(t, err)
+	insert(tx, "larry@stooges.com")
+
+	rolledBack, err := tx.Begin()
+	require.NoError(t, err)
+	insert(rolledBack, "moe@stooges.com")
+	require.NoError(t, rolledBack.Rollback())
+	require.Error(t, rolledBack.Commit())
+
+	committed, err := tx.Begin()
+	require.NoError(t, err)
+	insert(committed, "curly@stooges.com")
+	inner, err := committed.Begin()
+	require.NoError(t, err)
+	insert(inner, "shemp@stooges.com")
+	require.NoError(t, inner.Commit())
+	require.NoError(t, committed.Commit())
+
+	require.NoError(t, tx.Commit())
+
+	emails := []struct{ Email string }{}
+	err = db.Select(&emails, `SELECT email FROM users ORDER BY id`)
+	require.NoError(t, err)
+	require.Equal(t, []struct{ Email string }{
+		{"larry@stooges.com"}, {"curly@stooges.com"}, {"shemp@stooges.com"},
+	}, emails)
+}
+
+func TestTransactionCallbacks(t *testing.T) {
+	db := databaseFixture(t)
+	defer db.Close()
+
+	events := []string{}
+	record := func(tx *sequel.Transaction, name string) {
+		tx.OnCommit(func() { events = append(events, name+" committed") })
+		tx.OnRollback(func() { events = append(events, name+" rolled back") })
+	}
+
+	tx, err := db.Begin()
+	require.NoError(t, err)
+	record(tx, "outer")
+
+	nested, err := tx.Begin()
+	require.NoError(t, err)
+	record(nested, "released")
+	require.NoError(t, nested.Commit())
+
+	nested, err = tx.Begin()
+	require.NoError(t, err)
+	record(nested, "savepoint")
+	require.NoError(t, nested.Rollback())
+	require.Equal(t, []string{"savepoint rolled back"}, events)
+
+	err = nil
+	tx.CommitOrRollbackOnError(&err)
+	require.NoError(t, err)
+	require.Equal(t, []string{"savepoint rolled back", "outer committed", "released committed"}, events)
+
+	events = nil
+	tx, err = db.Begin()
+	require.NoError(t, err)
+	record(tx, "outer")
+	nested, err = tx.Begin()
+	require.NoError(t, err)
+	record(nested, "released")
+	require.NoError(t, nested.Commit())
+	require.NoError(t, tx.Rollback())
+	require.Error(t, tx.Rollback())
+	require.Equal(t, []string{"outer rolled back", "released rolled back"}, events)
+}
+
+func TestTransactor(t *testing.T) {
+	// A repository function that can be called with a DB or a Transaction.
+	createUser := func(db sequel.Transactor, email string, fail error) error {
+		return db.RunInTx(context.Background(), nil, func(tx *sequel.Transaction) error {
+			_, err := tx.Exec(`INSERT INTO users (email) VALUES (?)`, email)
+			require.NoError(t, err)
+			return fail
+		})
+	}
+	tests := []struct {
+		name    string
+		nesting sequel.Nesting
+		run     func(t *testing.T, db *sequel.DB)
+		count   int
+	}{
+		{name: "DB",
+			run: func(t *testing.T, db *sequel.DB) {
+				require.NoError(t, createUser(db, "larry@stooges.com", nil))
+				require.Error(t, createUser(db, "moe@stooges.com", errors.New("error")))
+			},
+			count: 1},
+		{name: "Savepoint",
+			run: func(t *testing.T, db *sequel.DB) {
+				err := db.RunInTx(context.Background(), nil, func(tx *sequel.Transaction) error {
+					require.NoError(t, createUser(tx, "larry@stooges.com", nil))
+					require.Error(t, createUser(tx, "moe@stooges.com", errors.New("error")))
+					return nil
+				})
+				require.NoError(t, err)
+			},
+			count: 1},
+		{name: "Join",
+			nesting: sequel.NestJoin,
+			run: func(t *testing.T, db *sequel.DB) {
+				err := db.RunInTx(context.Background(), nil, func(tx *sequel.Transaction) error {
+					require.NoError(t, createUser(tx, "larry@stooges.com", nil))
+					return nil
+				})
+				require.NoError(t, err)
+			},
+			count: 1},
+		{name: "JoinRollbackIsRollbackOnly",
+			nesting: sequel.NestJoin,
+			run: func(t *testing.T, db *sequel.DB) {
+				err := db.RunInTx(context.Background(), nil, func(tx *sequel.Transaction) error {
+					require.NoError(t, createUser(tx, "larry@stooges.com", nil))
+					require.Error(t, createUser(tx, "moe@stooges.com", errors.New("error")))
+					return nil
+				})
+				require.Equal(t, sequel.ErrRollbackOnly, err)
+			},
+			count: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := databaseFixture(t, sequel.WithNesting(test.nesting))
+			defer db.Close()
+
+			test.run(t, db)
+			count, err := db.SelectInt(`SELECT COUNT(*) FROM users`)
+			require.NoError(t, err)
+			require.Equal(t, test.count, count)
+		})
+	}
+}
+
+func TestRunInTx(t *testing.T) {
+	deadlock := &sequel.Error{Kind: sequel.Deadlock, Err: errors.New("deadlock")}
+	tests := []struct {
+		name     string
+		options  []sequel.Option
+		errs     []error
+		attempts int
+		count    int
+		err      bool
+	}{
+		{name: "Commits", errs: []error{nil}, attempts: 1, count: 1},
+		{name: "RollsBackOnError", errs: []error{errors.New("error")}, attempts: 1, count: 0, err: true},
+		{name: "RetriesRetryableErrors", errs: []error{deadlock, deadlock, nil}, attempts: 3, count: 1},
+		{name: "DoesNotRetryNonRetryableErrors", errs: []error{deadlock, errors.New("error"), nil}, attempts: 2, err: true},
+		{name: "GivesUpAfterRetryBudget", errs: []error{deadlock, deadlock, deadlock, nil}, attempts: 3, err: true},
+		{name: "ZeroBackoff",
+			options:  []sequel.Option{sequel.WithTxRetries(3, 0)},
+			errs:     []error{deadlock, deadlock, nil},
+			attempts: 3,
+			count:    1},
+		{name: "ClampsInvalidRetries",
+			options:  []sequel.Option{sequel.WithTxRetries(0, -time.Second)},
+			errs:     []error{deadlock, nil},
+			attempts: 1,
+			err:      true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.options == nil {
+				test.options = []sequel.Option{sequel.WithTxRetries(3, time.Millisecond)}
+			}
+			db := databaseFixture(t, test.options...)
+			defer db.Close()
+
+			attempts := 0
+			err := db.RunInTx(context.Background(), nil, func(tx *sequel.Transaction) error {
+				_, err := tx.Exec(`INSERT INTO users (name, email) VALUES (?, ?)`, "Larry", "larry@stooges.com")
+				require.NoError(t, err)
+				err = test.errs[attempts]
+				attempts++
+				return err
+			})
+			if test.err {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, test.attempts, attempts)
+			count, err := db.SelectInt(`SELECT COUNT(*) FROM users`)
+			require.NoError(t, err)
+			require.Equal(t, test.count, count)
+		})
+	}
+}
+
 func TestInsert(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -197,6 +1160,11 @@ func TestInsert(t *testing.T) {
 			{Email: "moe@stooges.com"},
 			{Email: "larry@stooges.com"},
 		}, expectedIDs: []int64{1, 2}},
+		{name: "Maps", value: []map[string]interface{}{
+			{"email": "moe@stooges.com"},
+			{"email": "larry@stooges.com", "name": "Larry"},
+		}, expectedIDs: []int64{1, 2}},
+		{name: "InvalidMapColumn", value: map[string]interface{}{"mail": "moe@stooges.com"}, err: true},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -219,6 +1187,26 @@ func TestInsert(t *testing.T) {
 	}
 }
 
+func TestInsertMaps(t *testing.T) {
+	db := databaseFixture(t)
+	defer db.Close()
+	ids, err := db.Insert("users",
+		map[string]interface{}{"email": "moe@stooges.com"},
+		map[string]interface{}{"name": "Larry", "email": "larry@stooges.com"})
+	require.NoError(t, err)
+	require.Equal(t, []int64{1, 2}, ids)
+	actual := []user{}
+	err = db.Select(&actual, `SELECT * FROM users ORDER BY id`)
+	require.NoError(t, err)
+	require.Equal(t, []user{
+		{ID: 1, Email: "moe@stooges.com"},
+		{ID: 2, Name: str("Larry"), Email: "larry@stooges.com"},
+	}, actual)
+
+	_, err = db.Insert("users", map[string]interface{}{})
+	require.EqualError(t, err, "no columns to insert")
+}
+
 func TestUpsert(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -235,6 +1223,23 @@ func TestUpsert(t *testing.T) {
 			value:         user{ID: 4, Name: str("Fred"), Email: "fred@stooges.com"},
 			expected:      &user{ID: 4, Name: str("Fred"), Email: "fred@stooges.com"},
 			expectedCount: 1},
+		{name: "Map",
+			value:         map[string]interface{}{"id": 1, "email": "bob@stooges.com"},
+			expected:      &user{ID: 1, Name: str("Larry"), Email: "bob@stooges.com"},
+			expectedCount: 1},
+		{name: "MapsWithDifferentKeys",
+			value: []map[string]interface{}{
+				{"id": 1, "email": "bob@stooges.com"},
+				{"id": 2, "name": "Curly", "email": "curly@stooges.com"},
+			},
+			err: true},
+		{name: "Maps",
+			value: []map[string]interface{}{
+				{"id": 1, "email": "bob@stooges.com"},
+				{"id": 4, "email": "fred@stooges.com"},
+			},
+			expected:      &user{ID: 4, Email: "fred@stooges.com"},
+			expectedCount: 2},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -265,9 +1270,61 @@ func TestUpsert(t *testing.T) {
 	}
 }
 
-func databaseFixture(t *testing.T) *sequel.DB {
+func TestErrorClassification(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		args     []interface{}
+		kind     sequel.ErrorKind
+		table    string
+		column   string
+		is       func(err error) bool
+		notError bool
+	}{
+		{name: "UniqueViolation",
+			query:  `INSERT INTO users (id, email) VALUES (?, ?)`,
+			args:   []interface{}{1, "larry@stooges.com"},
+			kind:   sequel.UniqueViolation,
+			table:  "users",
+			column: "id",
+			is:     sequel.IsUniqueViolation},
+		{name: "NotNullViolation",
+			query:  `INSERT INTO users (name) VALUES (?)`,
+			args:   []interface{}{"Shemp"},
+			kind:   sequel.NotNullViolation,
+			table:  "users",
+			column: "email",
+			is:     sequel.IsNotNullViolation},
+		{name: "Unclassified",
+			query:    `SELECT nmame FROM users`,
+			notError: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := databaseFixture(t)
+			defer db.Close()
+			insertFixtures(t, db)
+
+			_, err := db.Exec(test.query, test.args...)
+			require.Error(t, err)
+			serr, ok := sequel.AsError(err)
+			if test.notError {
+				require.False(t, ok, "%s", err)
+				return
+			}
+			require.True(t, ok, "%s", err)
+			require.Equal(t, test.kind, serr.Kind)
+			require.Equal(t, test.table, serr.Table)
+			require.Equal(t, test.column, serr.Column)
+			require.True(t, test.is(err))
+			require.False(t, sequel.IsRetryable(err))
+		})
+	}
+}
+
+func databaseFixture(t *testing.T, options ...sequel.Option) *sequel.DB {
 	t.Helper()
-	db, err := sequel.Open("sqlite3", ":memory:")
+	db, err := sequel.Open("sqlite3", ":memory:", options...)
 	require.NoError(t, err)
 	_, err = db.Exec(`
 	CREATE TABLE users (
@@ -280,6 +1337,23 @@ func databaseFixture(t *testing.T) *sequel.DB {
 	return db
 }
 
+func insertAccountFixtures(t *testing.T, db *sequel.DB) {
+	t.Helper()
+	_, err := db.Exec(`
+	CREATE TABLE accounts (
+		id INTEGER PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users(id),
+		name STRING NOT NULL
+	)
+	`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO accounts (**) VALUES ?`, []account{
+		{1, 1, "Larry's"},
+		{2, 3, "Curly's"},
+	})
+	require.NoError(t, err)
+}
+
 func str(p string) sql.NullString { return sql.NullString{String: p, Valid: true} }
 
 func insertFixtures(t *testing.T, db *sequel.DB) {
@@ -1,6 +1,7 @@
 package sequel
 
 import (
+	"context"
 	"database/sql"
 	"database/sql/driver"
 	"fmt"
@@ -8,19 +9,24 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
+
+	"github.com/alecthomas/sequel/internal/syntax"
 )
 
 var (
-	lexerRegex = regexp.MustCompile(
-		"(\\?)|" +
-			"(\\*\\*)|" +
-			"(\\*)|" +
-			"(\"(?:\\.|[^\"])*\")|" +
-			"('(?:\\.|[^'])*')|" +
-			"(`(?:\\.|[^`])*`)|" +
-			"([^$*?\"']+)")
+	lexerRegex = syntax.Lexer
+	// Matches statements in which "**" expands to the columns to insert.
+	insertStatementRegex = regexp.MustCompile(`(?i)^\s*(?:INSERT|REPLACE)\b`)
+
+	mysqlDuplicateKeyRegex = regexp.MustCompile("for key '(?:([^'.]+)\\.)?([^']+)'")
+	mysqlForeignKeyRegex   = regexp.MustCompile("\\(`[^`]+`\\.`([^`]+)`, CONSTRAINT `([^`]+)` FOREIGN KEY \\(`([^`]+)`")
+	mysqlColumnRegex       = regexp.MustCompile("(?:Column|Field) '([^']+)'")
+	mysqlCheckRegex        = regexp.MustCompile("Check constraint '([^']+)'")
+	sqliteConstraintRegex  = regexp.MustCompile(`constraint failed: ([^.,\s]+)(?:\.([^,\s]+))?`)
 
 	dialects = func() map[string]dialect {
 		out := map[string]dialect{
@@ -59,12 +65,155 @@ type dialect interface {
 	QuoteID(s string) string
 	// Return the dialect-specific placeholder string for parameter "n".
 	Placeholder(n int) string
+	// Return the value for columns missing from a row of a multi-row INSERT, eg. DEFAULT.
+	Default() string
 	// Constructs an upsert statement.
 	//
-	// Must return a statement with a single ? where values will be inserted.
-	Upsert(table string, keys []string, builder *builder) string
+	// "values" is inserted verbatim after VALUES, eg. "?" for values to be expanded.
+	Upsert(table string, keys []string, builder *builder, values string) string
 	// Insert rows, returning the IDs inserted.
-	Insert(ops sqlOps, table string, rows []interface{}) ([]int64, error)
+	Insert(ops sqlOps, m *mapper, table string, rows []interface{}) ([]int64, error)
+	// Normalise a driver error, returning nil if it is not recognised.
+	ClassifyError(err error) *Error
+	// Begin a transaction.
+	//
+	// Dialects whose drivers ignore sql.TxOptions must issue equivalent statements themselves.
+	Begin(ctx context.Context, db *sql.DB, opts *sql.TxOptions) (txOps, error)
+	// Return the value to bind a slice as a single array parameter, or an error if arrays are not supported.
+	Array(slice interface{}) (interface{}, error)
+	// Return the columns of a table in the current database or schema, or none if it does not exist.
+	Columns(ops sqlOps, table string) ([]Column, error)
+	// Return the names of the tables in the current database or schema.
+	Tables(ops sqlOps) ([]string, error)
+}
+
+// Query the name, type, nullability, whether it has a default, whether it is auto-increment, and
+// whether it is part of the primary key, of each column in table.
+//
+// The query is passed the table's name and schema, or "" for the current schema.
+func queryColumns(ops sqlOps, query string, table string) ([]Column, error) {
+	schema, name := splitTableName(table)
+	rows, err := ops.Query(query, name, schema)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Column{}
+	for rows.Next() {
+		column := Column{}
+		err := rows.Scan(&column.Name, &column.Type, &column.Nullable, &column.HasDefault, &column.AutoIncrement, &column.PrimaryKey)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, column)
+	}
+	return out, rows.Err()
+}
+
+// Query a single column of table names.
+func queryTables(ops sqlOps, query string) ([]string, error) {
+	rows, err := ops.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []string{}
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return nil, err
+		}
+		out = append(out, table)
+	}
+	return out, rows.Err()
+}
+
+// Begin a transaction with the driver's own support for sql.TxOptions.
+func beginDriverTx(ctx context.Context, db *sql.DB, opts *sql.TxOptions) (txOps, error) {
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// A transaction started by issuing statements directly on a dedicated connection.
+//
+// As with sql.Tx, the transaction is rolled back and the connection released if the context is
+// cancelled before the transaction completes.
+type connTx struct {
+	ctx  context.Context
+	conn *sql.Conn
+	// Statements that restore the connection's state once the transaction completes.
+	reset []string
+	lock  sync.Mutex
+	// Closed once the transaction completes.
+	done chan struct{}
+}
+
+func beginConnTx(ctx context.Context, db *sql.DB, begin, reset []string) (*connTx, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tx := &connTx{ctx: ctx, conn: conn, reset: reset, done: make(chan struct{})}
+	for _, stmt := range begin {
+		if _, err = conn.ExecContext(ctx, stmt); err != nil {
+			_ = tx.end("ROLLBACK")
+			return nil, err
+		}
+	}
+	if ctx.Done() != nil {
+		go tx.awaitCancel()
+	}
+	return tx, nil
+}
+
+func (c *connTx) awaitCancel() {
+	select {
+	case <-c.ctx.Done():
+		_ = c.end("ROLLBACK")
+	case <-c.done:
+	}
+}
+
+func (c *connTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.conn.ExecContext(c.ctx, query, args...)
+}
+
+func (c *connTx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.conn.QueryContext(c.ctx, query, args...)
+}
+
+func (c *connTx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.conn.QueryRowContext(c.ctx, query, args...)
+}
+
+func (c *connTx) Commit() error   { return c.end("COMMIT") }
+func (c *connTx) Rollback() error { return c.end("ROLLBACK") }
+
+func (c *connTx) end(stmt string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	select {
+	case <-c.done:
+		return sql.ErrTxDone
+	default:
+	}
+	close(c.done)
+	defer c.conn.Close()
+	// Use a fresh context so that the transaction is always terminated.
+	ctx := context.Background()
+	_, err := c.conn.ExecContext(ctx, stmt)
+	if err != nil && stmt != "ROLLBACK" {
+		_, _ = c.conn.ExecContext(ctx, "ROLLBACK")
+	}
+	for _, reset := range c.reset {
+		if _, rerr := c.conn.ExecContext(ctx, reset); rerr != nil && err == nil {
+			err = rerr
+		}
+	}
+	return err
 }
 
 type lastInsertMixin struct {
@@ -72,12 +221,27 @@ type lastInsertMixin struct {
 	idIsFirst bool // MySQL returns the FIRST inserted ID ... because why wouldn't it.
 }
 
-func (l *lastInsertMixin) Insert(ops sqlOps, table string, rows []interface{}) ([]int64, error) {
+func (l *lastInsertMixin) Insert(ops sqlOps, m *mapper, table string, rows []interface{}) ([]int64, error) {
+	if maps, ok := asMapRows(rows); ok {
+		query, args, err := maps.insert(l.d, table)
+		if err != nil {
+			return nil, err
+		}
+		result, err := ops.Exec(query, args...)
+		if err != nil {
+			return nil, errors.Wrapf(classifyError(l.d, err), "failed to execute %q", query)
+		}
+		return l.insertedIDs(result, len(maps.rows))
+	}
 	arg, count, t, slice := typeForMutationRows(rows...)
-	builder, err := makeRowBuilderForType(t)
+	builder, err := m.makeRowBuilderForType(t)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to map type %s", t)
 	}
+	builder = m.restrict(builder)
+	if err := builder.checkMutable(); err != nil {
+		return nil, err
+	}
 	elem := slice.Index(0)
 	if elem.Kind() == reflect.Interface {
 		elem = elem.Elem()
@@ -89,14 +253,34 @@ func (l *lastInsertMixin) Insert(ops sqlOps, table string, rows []interface{}) (
 	query := fmt.Sprintf(`INSERT INTO %s (%s) VALUES ?`,
 		l.d.QuoteID(table),
 		quoteAndJoinIDs(l.d.QuoteID, builder.filteredFields(false)))
-	query, args, err := expand(l.d, false, builder, query, []interface{}{arg})
+	query, args, err := expand(l.d, m, false, builder, query, []interface{}{arg})
 	if err != nil {
 		return nil, err
 	}
 	result, err := ops.Exec(query, args...)
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to execute %q", query)
+		return nil, errors.Wrapf(classifyError(l.d, err), "failed to execute %q", query)
+	}
+	ids, err := l.insertedIDs(result, count)
+	if err != nil || ids == nil {
+		return nil, err
+	}
+
+	// Set IDs on the rows.
+	if builder.pk != "" {
+		for i := 0; i < slice.Len(); i++ {
+			f := builder.fieldMap[builder.pk]
+			row := indirectValue(slice.Index(i))
+			rf := row.FieldByIndex(f.index)
+			rf.SetInt(ids[i])
+		}
 	}
+
+	return ids, nil
+}
+
+// Derive the IDs of "count" inserted rows from the last insert ID, or nil if not supported.
+func (l *lastInsertMixin) insertedIDs(result sql.Result, count int) ([]int64, error) {
 	affected, err := result.RowsAffected()
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to count affected rows")
@@ -120,17 +304,6 @@ func (l *lastInsertMixin) Insert(ops sqlOps, table string, rows []interface{}) (
 			ids = append(ids, id)
 		}
 	}
-
-	// Set IDs on the rows.
-	if builder.pk != "" {
-		for i := 0; i < slice.Len(); i++ {
-			f := builder.fieldMap[builder.pk]
-			row := indirectValue(slice.Index(i))
-			rf := row.FieldByIndex(f.index)
-			rf.SetInt(ids[i])
-		}
-	}
-
 	return ids, nil
 }
 
@@ -146,7 +319,8 @@ func (m *mysqlDialect) Detect(db *sql.DB) bool {
 func (m *mysqlDialect) Name() string             { return "mysql" }
 func (m *mysqlDialect) QuoteID(s string) string  { return quoteBacktick(s) }
 func (m *mysqlDialect) Placeholder(n int) string { return "?" }
-func (m *mysqlDialect) Upsert(table string, keys []string, builder *builder) string {
+func (m *mysqlDialect) Default() string          { return "DEFAULT" }
+func (m *mysqlDialect) Upsert(table string, keys []string, builder *builder, values string) string {
 	set := []string{}
 	for _, field := range builder.filteredFields(true) {
 		set = append(set, fmt.Sprintf("%s=VALUES(%s)",
@@ -154,19 +328,84 @@ func (m *mysqlDialect) Upsert(table string, keys []string, builder *builder) str
 	}
 	// nolint: gosec
 	return fmt.Sprintf(`
-			INSERT INTO %s (%s) VALUES ?
+			INSERT INTO %s (%s) VALUES %s
 			ON DUPLICATE KEY UPDATE %s
 		`,
 		quoteBacktick(table),
 		quoteAndJoinIDs(quoteBacktick, builder.filteredFields(true)),
-		strings.Join(set, ","))
+		values, strings.Join(set, ","))
+}
+
+func (m *mysqlDialect) Begin(ctx context.Context, db *sql.DB, opts *sql.TxOptions) (txOps, error) {
+	return beginDriverTx(ctx, db, opts)
+}
+
+func (m *mysqlDialect) Array(slice interface{}) (interface{}, error) {
+	return nil, errors.Errorf("array parameters are not supported by %s", m.Name())
+}
+
+func (m *mysqlDialect) Columns(ops sqlOps, table string) ([]Column, error) {
+	return queryColumns(ops, `
+		SELECT column_name, column_type, is_nullable = 'YES',
+			column_default IS NOT NULL, extra LIKE '%auto_increment%', column_key = 'PRI'
+		FROM information_schema.columns
+		WHERE table_name = ? AND table_schema = COALESCE(NULLIF(?, ''), DATABASE())
+		ORDER BY ordinal_position
+	`, table)
+}
+
+func (m *mysqlDialect) Tables(ops sqlOps) ([]string, error) {
+	return queryTables(ops, `
+		SELECT table_name
+		FROM information_schema.tables
+		WHERE table_schema = DATABASE() AND table_type = 'BASE TABLE'
+		ORDER BY table_name
+	`)
+}
+
+func (m *mysqlDialect) ClassifyError(err error) *Error {
+	derr, ok := findDriverError(err, "github.com/go-sql-driver/mysql", "MySQLError")
+	if !ok {
+		return nil
+	}
+	message := derr.string("Message")
+	out := &Error{Err: err}
+	switch derr.int("Number") {
+	case 1062: // ER_DUP_ENTRY
+		out.Kind = UniqueViolation
+		if groups := mysqlDuplicateKeyRegex.FindStringSubmatch(message); groups != nil {
+			out.Table, out.Constraint = groups[1], groups[2]
+		}
+	case 1216, 1217, 1451, 1452: // ER_NO_REFERENCED_ROW, ER_ROW_IS_REFERENCED, ...
+		out.Kind = ForeignKeyViolation
+		if groups := mysqlForeignKeyRegex.FindStringSubmatch(message); groups != nil {
+			out.Table, out.Constraint, out.Column = groups[1], groups[2], groups[3]
+		}
+	case 1048, 1364: // ER_BAD_NULL_ERROR, ER_NO_DEFAULT_FOR_FIELD
+		out.Kind = NotNullViolation
+		if groups := mysqlColumnRegex.FindStringSubmatch(message); groups != nil {
+			out.Column = groups[1]
+		}
+	case 3819: // ER_CHECK_CONSTRAINT_VIOLATED
+		out.Kind = CheckViolation
+		if groups := mysqlCheckRegex.FindStringSubmatch(message); groups != nil {
+			out.Constraint = groups[1]
+		}
+	case 1213: // ER_LOCK_DEADLOCK
+		out.Kind = Deadlock
+	case 1205: // ER_LOCK_WAIT_TIMEOUT
+		out.Kind = LockTimeout
+	default:
+		return nil
+	}
+	return out
 }
 
 type ansiUpsertMixin struct {
 	d dialect
 }
 
-func (a *ansiUpsertMixin) Upsert(table string, keys []string, builder *builder) string {
+func (a *ansiUpsertMixin) Upsert(table string, keys []string, builder *builder, values string) string {
 	set := []string{}
 	for _, field := range builder.filteredFields(true) {
 		// nolint: gosec
@@ -175,13 +414,13 @@ func (a *ansiUpsertMixin) Upsert(table string, keys []string, builder *builder)
 	}
 	// nolint: gosec
 	return fmt.Sprintf(`
-			INSERT INTO %s (%s) VALUES ?
+			INSERT INTO %s (%s) VALUES %s
 			ON CONFLICT (%s)
 			DO UPDATE SET %s
 		`,
 		a.d.QuoteID(table),
 		quoteAndJoinIDs(a.d.QuoteID, builder.filteredFields(true)),
-		quoteAndJoinIDs(a.d.QuoteID, keys), strings.Join(set, ", "))
+		values, quoteAndJoinIDs(a.d.QuoteID, keys), strings.Join(set, ", "))
 }
 
 type sqliteDialect struct {
@@ -200,6 +439,97 @@ func (s *sqliteDialect) Name() string           { return "sqlite" }
 func (*sqliteDialect) QuoteID(s string) string  { return quoteBacktick(s) }
 func (*sqliteDialect) Placeholder(n int) string { return "?" }
 
+// SQLite does not support DEFAULT in VALUES lists.
+func (*sqliteDialect) Default() string { return "NULL" }
+
+// The SQLite driver ignores sql.TxOptions, so we issue the equivalent statements ourselves.
+func (s *sqliteDialect) Begin(ctx context.Context, db *sql.DB, opts *sql.TxOptions) (txOps, error) {
+	if opts == nil || (opts.Isolation == sql.LevelDefault && !opts.ReadOnly) {
+		return beginDriverTx(ctx, db, opts)
+	}
+	var begin, reset []string
+	switch opts.Isolation {
+	case sql.LevelSerializable:
+		begin = append(begin, "BEGIN IMMEDIATE")
+	case sql.LevelLinearizable:
+		begin = append(begin, "BEGIN EXCLUSIVE")
+	default:
+		// SQLite transactions are always serializable, which satisfies any weaker level.
+		begin = append(begin, "BEGIN DEFERRED")
+	}
+	if opts.ReadOnly {
+		begin = append(begin, "PRAGMA query_only = ON")
+		reset = append(reset, "PRAGMA query_only = OFF")
+	}
+	tx, err := beginConnTx(ctx, db, begin, reset)
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+func (s *sqliteDialect) Array(slice interface{}) (interface{}, error) {
+	return nil, errors.Errorf("array parameters are not supported by %s", s.Name())
+}
+
+func (s *sqliteDialect) Columns(ops sqlOps, table string) ([]Column, error) {
+	// Primary keys are reported as nullable unless declared NOT NULL, but are treated as non-nullable
+	// here. An INTEGER PRIMARY KEY is an alias for the auto-assigned rowid.
+	return queryColumns(ops, `
+		SELECT name, type, NOT "notnull" AND pk = 0, dflt_value IS NOT NULL,
+			pk = 1 AND upper(type) = 'INTEGER' AND (SELECT COUNT(*) FROM pragma_table_info(?1, NULLIF(?2, '')) WHERE pk > 0) = 1,
+			pk > 0
+		FROM pragma_table_info(?1, NULLIF(?2, ''))
+		ORDER BY cid
+	`, table)
+}
+
+func (s *sqliteDialect) Tables(ops sqlOps) ([]string, error) {
+	return queryTables(ops, `
+		SELECT name
+		FROM sqlite_master
+		WHERE type = 'table' AND name NOT LIKE 'sqlite_%'
+		ORDER BY name
+	`)
+}
+
+func (s *sqliteDialect) ClassifyError(err error) *Error {
+	derr, ok := findDriverError(err, "github.com/mattn/go-sqlite3", "Error")
+	if !ok {
+		return nil
+	}
+	message := derr.message
+	out := &Error{Err: err}
+	switch derr.int("Code") {
+	case 19: // SQLITE_CONSTRAINT
+		switch derr.int("ExtendedCode") {
+		case 2067, 1555: // SQLITE_CONSTRAINT_UNIQUE, SQLITE_CONSTRAINT_PRIMARYKEY
+			out.Kind = UniqueViolation
+		case 787: // SQLITE_CONSTRAINT_FOREIGNKEY
+			out.Kind = ForeignKeyViolation
+		case 1299: // SQLITE_CONSTRAINT_NOTNULL
+			out.Kind = NotNullViolation
+		case 275: // SQLITE_CONSTRAINT_CHECK
+			out.Kind = CheckViolation
+		default:
+			return nil
+		}
+		// eg. "UNIQUE constraint failed: users.email" or "CHECK constraint failed: positive_age"
+		if groups := sqliteConstraintRegex.FindStringSubmatch(message); groups != nil {
+			if out.Kind == CheckViolation {
+				out.Constraint = groups[1]
+			} else {
+				out.Table, out.Column = groups[1], groups[2]
+			}
+		}
+	case 5: // SQLITE_BUSY
+		out.Kind = LockTimeout
+	default:
+		return nil
+	}
+	return out
+}
+
 type pqDialect struct{ ansiUpsertMixin }
 
 var _ dialect = &pqDialect{}
@@ -212,13 +542,90 @@ func (p *pqDialect) Detect(db *sql.DB) bool {
 func (p *pqDialect) Name() string             { return "postgres" }
 func (p *pqDialect) QuoteID(s string) string  { return strconv.Quote(s) }
 func (p *pqDialect) Placeholder(n int) string { return fmt.Sprintf("$%d", n+1) }
+func (p *pqDialect) Default() string          { return "DEFAULT" }
+
+func (p *pqDialect) Begin(ctx context.Context, db *sql.DB, opts *sql.TxOptions) (txOps, error) {
+	return beginDriverTx(ctx, db, opts)
+}
 
-func (p *pqDialect) Insert(ops sqlOps, table string, rows []interface{}) ([]int64, error) {
+func (p *pqDialect) Array(slice interface{}) (interface{}, error) {
+	return pq.Array(slice), nil
+}
+
+func (p *pqDialect) Columns(ops sqlOps, table string) ([]Column, error) {
+	return queryColumns(ops, `
+		SELECT c.column_name, c.data_type, c.is_nullable = 'YES',
+			c.column_default IS NOT NULL, COALESCE(c.column_default LIKE 'nextval(%' OR c.is_identity = 'YES', false),
+			EXISTS (
+				SELECT 1
+				FROM information_schema.table_constraints tc
+				JOIN information_schema.key_column_usage kcu
+					ON kcu.constraint_schema = tc.constraint_schema AND kcu.constraint_name = tc.constraint_name
+				WHERE tc.constraint_type = 'PRIMARY KEY' AND tc.table_schema = c.table_schema
+					AND tc.table_name = c.table_name AND kcu.column_name = c.column_name
+			)
+		FROM information_schema.columns c
+		WHERE c.table_name = $1 AND c.table_schema = COALESCE(NULLIF($2, ''), current_schema())
+		ORDER BY c.ordinal_position
+	`, table)
+}
+
+func (p *pqDialect) Tables(ops sqlOps) ([]string, error) {
+	return queryTables(ops, `
+		SELECT table_name
+		FROM information_schema.tables
+		WHERE table_schema = current_schema() AND table_type = 'BASE TABLE'
+		ORDER BY table_name
+	`)
+}
+
+func (p *pqDialect) ClassifyError(err error) *Error {
+	derr, ok := findDriverError(err, "github.com/lib/pq", "Error")
+	if !ok {
+		return nil
+	}
+	out := &Error{Err: err, Constraint: derr.string("Constraint"), Table: derr.string("Table"),
+		Column: derr.string("Column")}
+	switch derr.string("Code") {
+	case "23505": // unique_violation
+		out.Kind = UniqueViolation
+	case "23503": // foreign_key_violation
+		out.Kind = ForeignKeyViolation
+	case "23502": // not_null_violation
+		out.Kind = NotNullViolation
+	case "23514": // check_violation
+		out.Kind = CheckViolation
+	case "40P01": // deadlock_detected
+		out.Kind = Deadlock
+	case "40001": // serialization_failure
+		out.Kind = SerializationFailure
+	default:
+		return nil
+	}
+	return out
+}
+
+func (p *pqDialect) Insert(ops sqlOps, m *mapper, table string, rows []interface{}) ([]int64, error) {
+	if maps, ok := asMapRows(rows); ok {
+		query, args, err := maps.insert(p, table)
+		if err != nil {
+			return nil, err
+		}
+		// The primary key of a map is unknown, so as with structs without a PK no IDs are returned.
+		if _, err = ops.Exec(query, args...); err != nil {
+			return nil, errors.Wrapf(classifyError(p, err), "failed to execute %q", query)
+		}
+		return nil, nil
+	}
 	arg, count, t, slice := typeForMutationRows(rows...)
-	builder, err := makeRowBuilderForType(t)
+	builder, err := m.makeRowBuilderForType(t)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to map type %s", t)
 	}
+	builder = m.restrict(builder)
+	if err := builder.checkMutable(); err != nil {
+		return nil, err
+	}
 	elem := slice.Index(0)
 	if elem.Kind() == reflect.Interface {
 		elem = elem.Elem()
@@ -234,13 +641,13 @@ func (p *pqDialect) Insert(ops sqlOps, table string, rows []interface{}) ([]int6
 	if builder.pk != "" {
 		query += fmt.Sprintf(` RETURNING %s`, p.QuoteID(builder.pk))
 	}
-	query, args, err := expand(p, false, builder, query, []interface{}{arg})
+	query, args, err := expand(p, m, false, builder, query, []interface{}{arg})
 	if err != nil {
 		return nil, err
 	}
 	outRows, err := ops.Query(query, args...)
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to execute %q", query)
+		return nil, errors.Wrapf(classifyError(p, err), "failed to execute %q", query)
 	}
 	defer outRows.Close()
 
@@ -263,7 +670,7 @@ func (p *pqDialect) Insert(ops sqlOps, table string, rows []interface{}) ([]int6
 		rf.SetInt(ids[i])
 		i++
 	}
-	return ids, outRows.Err()
+	return ids, classifyError(p, outRows.Err())
 }
 
 func quoteBacktick(s string) string {
@@ -283,7 +690,7 @@ func quoteAndJoinIDs(quoteID func(s string) string, ids []string) string {
 //
 // If "builder" is provided it will be used to interpolate any `**` placeholders.
 // If it is not provided, the matching positional argument will be used.
-func expand(d dialect, withManaged bool, b *builder, query string, args []interface{}) (string, []interface{}, error) {
+func expand(d dialect, m *mapper, withManaged bool, b *builder, query string, args []interface{}) (string, []interface{}, error) {
 	// Fragments of text making up the final statement.
 	w := &strings.Builder{}
 	out := []interface{}{}
@@ -299,24 +706,36 @@ func expand(d dialect, withManaged bool, b *builder, query string, args []interf
 			// Newly seen argument, expand and cache it.
 			arg := args[argi]
 			v := reflect.ValueOf(arg)
-			parameterArgs, err := expandParameter(d, withManaged, true, w, &outIndex, v)
+			parameterArgs, err := expandParameter(d, m, withManaged, true, w, &outIndex, v)
 			if err != nil {
 				return "", nil, err
 			}
 			out = append(out, parameterArgs...)
 			argi++
 
-		case match[2] == "**":
+		case match[3] == "**":
 			paramBuilder := b
 			if paramBuilder == nil {
+				if argi >= len(args) {
+					return "", nil, errors.Errorf("wildcard %d has no corresponding argument to expand", argi)
+				}
 				var err error
-				paramBuilder, err = makeRowBuilderForType(reflect.TypeOf(args[argi]))
+				paramBuilder, err = m.makeRowBuilderForType(reflect.TypeOf(args[argi]))
 				if err != nil {
 					return "", nil, err
 				}
 			}
-			// Wildcard - expand all column names.
-			w.WriteString(quoteAndJoinIDs(d.QuoteID, paramBuilder.fields))
+			if insertStatementRegex.MatchString(query) {
+				if err := paramBuilder.checkMutable(); err != nil {
+					return "", nil, err
+				}
+			}
+			// Wildcard - expand all column names, or those of a table for "t.**" and "**(t)".
+			columns, err := m.restrict(paramBuilder).columns(d, match[2], match[4])
+			if err != nil {
+				return "", nil, err
+			}
+			w.WriteString(columns)
 
 		default:
 			// Text fragment, output it.
@@ -329,7 +748,25 @@ func expand(d dialect, withManaged bool, b *builder, query string, args []interf
 // Expand a single parameter.
 //
 // Parentheses will enclose struct fields and slice elements unless "root" is true.
-func expandParameter(d dialect, withManaged, wrap bool, w *strings.Builder, index *int, v reflect.Value) ([]interface{}, error) { // nolint: interfacer
+func expandParameter(d dialect, m *mapper, withManaged, wrap bool, w *strings.Builder, index *int, v reflect.Value) ([]interface{}, error) { // nolint: interfacer
+	if codec := lookupCodec(v.Type()); codec != nil {
+		value, err := codec.encodeValue(v)
+		if err != nil {
+			return nil, err
+		}
+		w.WriteString(d.Placeholder(*index))
+		*index++
+		return []interface{}{value}, nil
+	}
+	if array, ok := v.Interface().(ArrayValue); ok {
+		value, err := d.Array(array.Slice)
+		if err != nil {
+			return nil, err
+		}
+		w.WriteString(d.Placeholder(*index))
+		*index++
+		return []interface{}{value}, nil
+	}
 	if _, ok := v.Interface().(driver.Valuer); ok {
 		w.WriteString(d.Placeholder(*index))
 		*index++
@@ -347,11 +784,17 @@ func expandParameter(d dialect, withManaged, wrap bool, w *strings.Builder, inde
 		return []interface{}{v.Interface()}, nil
 
 	case reflect.Slice, reflect.Array:
+		// Fixed-size byte arrays are scalars, eg. hashes.
+		if isByteArrayType(v.Type()) {
+			w.WriteString(d.Placeholder(*index))
+			*index++
+			return []interface{}{byteArray(v)}, nil
+		}
 		for i := 0; i < v.Len(); i++ {
 			if i > 0 {
 				w.WriteString(", ")
 			}
-			children, err := expandParameter(d, withManaged, wrap, w, index, v.Index(i))
+			children, err := expandParameter(d, m, withManaged, wrap, w, index, v.Index(i))
 			if err != nil {
 				return nil, err
 			}
@@ -363,17 +806,24 @@ func expandParameter(d dialect, withManaged, wrap bool, w *strings.Builder, inde
 			w.WriteString("(")
 		}
 		t := v.Type()
-		builder, err := makeRowBuilderForType(t)
+		builder, err := m.makeRowBuilderForType(t)
 		if err != nil {
 			return nil, err
 		}
+		builder = m.restrict(builder)
 		for i, name := range builder.filteredFields(withManaged) {
 			if i > 0 {
 				w.WriteString(", ")
 			}
 			field := builder.fieldMap[name]
-			fv := v.FieldByIndex(field.index)
-			out = append(out, fv.Interface())
+			var value interface{}
+			if fv, ok := fieldByIndex(v, field.index); ok {
+				value, err = m.encodeField(d, field, fv)
+				if err != nil {
+					return nil, err
+				}
+			}
+			out = append(out, value)
 			w.WriteString(d.Placeholder(*index))
 			*index++
 		}
@@ -388,14 +838,14 @@ func expandParameter(d dialect, withManaged, wrap bool, w *strings.Builder, inde
 			return []interface{}{nil}, nil
 		}
 		var err error
-		out, err = expandParameter(d, withManaged, wrap, w, index, v.Elem())
+		out, err = expandParameter(d, m, withManaged, wrap, w, index, v.Elem())
 		if err != nil {
 			return nil, err
 		}
 
 	case reflect.Interface:
 		var err error
-		out, err = expandParameter(d, withManaged, wrap, w, index, v.Elem())
+		out, err = expandParameter(d, m, withManaged, wrap, w, index, v.Elem())
 		if err != nil {
 			return nil, err
 		}
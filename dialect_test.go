@@ -1,8 +1,14 @@
 package sequel
 
 import (
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 )
 
@@ -135,7 +141,7 @@ func TestDialectExpand(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			for _, result := range test.expected {
 				t.Run(result.dialect.Name(), func(t *testing.T) {
-					query, args, err := expand(result.dialect, true, nil, test.query, test.args)
+					query, args, err := expand(result.dialect, newMapper(), true, nil, test.query, test.args)
 					require.NoError(t, err, "%q", test.query)
 					require.Equal(t, result.query, query)
 					require.Equal(t, result.args, args)
@@ -147,10 +153,290 @@ func TestDialectExpand(t *testing.T) {
 
 func TestDialectExpandSelect(t *testing.T) {
 	dest := []TestUser{}
-	builder, err := makeRowBuilderForSlice(&dest)
+	builder, err := newMapper().makeRowBuilderForSlice(&dest)
 	require.NoError(t, err)
-	query, args, err := expand(dialects["postgres"], true, builder, `SELECT ** FROM test`, []interface{}{dest})
+	query, args, err := expand(dialects["postgres"], newMapper(), true, builder, `SELECT ** FROM test`, []interface{}{dest})
 	require.NoError(t, err)
 	require.Equal(t, `SELECT "id", "name", "email", "age" FROM test`, query)
 	require.Empty(t, args)
 }
+
+func TestDialectExpandNestedSelect(t *testing.T) {
+	dest := []struct {
+		User    TestUser `db:"u"`
+		Account struct {
+			ID   int
+			Name string
+		} `db:"acct,prefix"`
+	}{}
+	builder, err := newMapper().makeRowBuilderForSlice(&dest)
+	require.NoError(t, err)
+	query, _, err := expand(dialects["postgres"], newMapper(), true, builder, `SELECT ** FROM test`, nil)
+	require.NoError(t, err)
+	require.Equal(t, `SELECT "u"."id" AS "u_id", "u"."name" AS "u_name", "u"."email" AS "u_email", "u"."age" AS "u_age", `+
+		`"acct"."id" AS "acct_id", "acct"."name" AS "acct_name" FROM test`, query)
+}
+
+func TestDialectExpandQualifiedSelect(t *testing.T) {
+	type nested struct {
+		User    TestUser `db:"u"`
+		Account struct {
+			ID   int
+			Name string
+		} `db:"acct,prefix"`
+	}
+	tests := []struct {
+		name     string
+		dest     interface{}
+		query    string
+		expected string
+		err      string
+	}{
+		{name: "Qualified",
+			dest:     []TestUser{},
+			query:    `SELECT u.**, 'u.**' FROM test u`,
+			expected: `SELECT "u"."id", "u"."name", "u"."email", "u"."age", 'u.**' FROM test u`},
+		{name: "Aliased",
+			dest:     []TestUser{},
+			query:    `SELECT **(u) FROM test u`,
+			expected: `SELECT "u"."id" AS "u_id", "u"."name" AS "u_name", "u"."email" AS "u_email", "u"."age" AS "u_age" FROM test u`},
+		{name: "Nested",
+			dest:  []nested{},
+			query: `SELECT acct.**, u.** FROM test u JOIN accounts acct`,
+			expected: `SELECT "acct"."id" AS "acct_id", "acct"."name" AS "acct_name", ` +
+				`"u"."id" AS "u_id", "u"."name" AS "u_name", "u"."email" AS "u_email", "u"."age" AS "u_age" FROM test u JOIN accounts acct`},
+		{name: "NestedAliased",
+			dest:     []nested{},
+			query:    `SELECT **(acct) FROM accounts acct`,
+			expected: `SELECT "acct"."id" AS "acct_id", "acct"."name" AS "acct_name" FROM accounts acct`},
+		{name: "UnknownTable",
+			dest:  []nested{},
+			query: `SELECT a.** FROM accounts a`,
+			err:   `map to table "a"`},
+	}
+	for _, test := range tests {
+		// nolint: scopelint
+		t.Run(test.name, func(t *testing.T) {
+			builder, err := newMapper().makeRowBuilder(test.dest)
+			require.NoError(t, err)
+			query, _, err := expand(dialects["postgres"], newMapper(), true, builder, test.query, nil)
+			if test.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), test.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, query)
+		})
+	}
+}
+
+func TestDialectExpandArray(t *testing.T) {
+	type document struct {
+		ID   int64
+		Tags []string `db:",array"`
+	}
+	query, args, err := expand(dialects["postgres"], newMapper(), true, nil,
+		`SELECT * FROM documents WHERE id = ANY(?) OR (id, tags) = ?`,
+		[]interface{}{Array([]int64{1, 2}), document{ID: 3, Tags: []string{"a"}}})
+	require.NoError(t, err)
+	require.Equal(t, `SELECT * FROM documents WHERE id = ANY($1) OR (id, tags) = ($2, $3)`, query)
+	require.Equal(t, []interface{}{pq.Array([]int64{1, 2}), int64(3), pq.Array([]string{"a"})}, args)
+
+	_, _, err = expand(dialects["mysql"], newMapper(), true, nil, `SELECT * FROM documents WHERE id = ANY(?)`,
+		[]interface{}{Array([]int64{1, 2})})
+	require.Error(t, err)
+
+	tags := []string{}
+	err = Array(&tags).Scan([]byte(`{a,"b c"}`))
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b c"}, tags)
+}
+
+func TestTargetTable(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{query: `SELECT ** FROM users WHERE id = ?`, expected: "users"},
+		{query: "INSERT INTO `users` (**) VALUES ?", expected: "users"},
+		{query: `UPDATE "users" SET name = ?`, expected: "users"},
+		{query: `SELECT ** FROM public.users`, expected: "public.users"},
+		{query: `SELECT ** FROM "public"."users"`, expected: "public.users"},
+		{query: `SELECT EXTRACT(YEAR FROM created), ** FROM users`, expected: "users"},
+		{query: `SELECT (SELECT COUNT(*) FROM accounts), ** FROM users`, expected: "users"},
+		{query: `SELECT ** FROM (SELECT * FROM users) AS u`, expected: ""},
+		{query: `SELECT 1`, expected: ""},
+	}
+	for _, test := range tests {
+		require.Equal(t, test.expected, targetTable(test.query), test.query)
+	}
+}
+
+// Has the same shape as *mysql.MySQLError, but is not declared by the driver.
+type MySQLError struct{ Number uint16 }
+
+func (e *MySQLError) Error() string { return "not a driver error" }
+
+func TestDialectClassifyError(t *testing.T) {
+	tests := []struct {
+		name     string
+		dialect  dialect
+		err      error
+		expected *Error
+	}{
+		{name: "MySQLDuplicateEntry",
+			dialect:  dialects["mysql"],
+			err:      &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'moe@stooges.com' for key 'users.email_idx'"},
+			expected: &Error{Kind: UniqueViolation, Table: "users", Constraint: "email_idx"}},
+		{name: "MySQLForeignKey",
+			dialect: dialects["mysql"],
+			err: &mysql.MySQLError{Number: 1452, Message: "Cannot add or update a child row: a foreign key constraint fails " +
+				"(`test`.`accounts`, CONSTRAINT `accounts_user_fk` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`))"},
+			expected: &Error{Kind: ForeignKeyViolation, Table: "accounts", Constraint: "accounts_user_fk", Column: "user_id"}},
+		{name: "MySQLNotNull",
+			dialect:  dialects["mysql"],
+			err:      &mysql.MySQLError{Number: 1048, Message: "Column 'email' cannot be null"},
+			expected: &Error{Kind: NotNullViolation, Column: "email"}},
+		{name: "MySQLDeadlock",
+			dialect:  dialects["mysql"],
+			err:      &mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"},
+			expected: &Error{Kind: Deadlock}},
+		{name: "MySQLUnknown",
+			dialect: dialects["mysql"],
+			err:     &mysql.MySQLError{Number: 1146, Message: "Table 'test.nope' doesn't exist"}},
+		{name: "PostgresUnique",
+			dialect:  dialects["postgres"],
+			err:      &pq.Error{Code: "23505", Table: "users", Constraint: "users_email_key"},
+			expected: &Error{Kind: UniqueViolation, Table: "users", Constraint: "users_email_key"}},
+		{name: "PostgresSerializationFailure",
+			dialect:  dialects["postgres"],
+			err:      &pq.Error{Code: "40001"},
+			expected: &Error{Kind: SerializationFailure}},
+		{name: "PostgresUnknown",
+			dialect: dialects["postgres"],
+			err:     &pq.Error{Code: "42P01"}},
+		{name: "PostgresLockNotAvailable",
+			dialect: dialects["postgres"],
+			err:     &pq.Error{Code: "55P03"}},
+		{name: "PostgresWrapped",
+			dialect:  dialects["postgres"],
+			err:      errors.Wrap(&pq.Error{Code: "40P01"}, "failed to execute"),
+			expected: &Error{Kind: Deadlock}},
+		{name: "MySQLWrapped",
+			dialect:  dialects["mysql"],
+			err:      errors.Wrap(&mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded"}, "failed to execute"),
+			expected: &Error{Kind: LockTimeout}},
+		{name: "SQLiteUnique",
+			dialect:  dialects["sqlite"],
+			err:      errors.Wrap(sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintUnique}, "failed to execute"),
+			expected: &Error{Kind: UniqueViolation}},
+		{name: "SQLiteBusy",
+			dialect:  dialects["sqlite"],
+			err:      sqlite3.Error{Code: sqlite3.ErrBusy},
+			expected: &Error{Kind: LockTimeout}},
+		{name: "SQLiteLocked",
+			dialect: dialects["sqlite"],
+			err:     sqlite3.Error{Code: sqlite3.ErrLocked}},
+		{name: "WrongDriver",
+			dialect: dialects["postgres"],
+			err:     &mysql.MySQLError{Number: 1062}},
+		{name: "NotADriverError",
+			dialect: dialects["mysql"],
+			err:     &MySQLError{Number: 1062}},
+	}
+	for _, test := range tests {
+		// nolint: scopelint
+		t.Run(test.name, func(t *testing.T) {
+			actual := test.dialect.ClassifyError(test.err)
+			if test.expected == nil {
+				require.Nil(t, actual)
+				return
+			}
+			test.expected.Err = test.err
+			require.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestDialectInsertMaps(t *testing.T) {
+	rows, ok := asMapRows([]interface{}{[]map[string]interface{}{
+		{"name": "Moe", "tags": Array([]string{"a"})},
+		{"email": "larry@stooges.com", "name": "Larry"},
+	}})
+	require.True(t, ok)
+	require.Equal(t, []string{"email", "name", "tags"}, rows.columns)
+
+	query, args, err := rows.insert(dialects["postgres"], "users")
+	require.NoError(t, err)
+	require.Equal(t, `INSERT INTO "users" ("email", "name", "tags") VALUES (DEFAULT, $1, $2), ($3, $4, DEFAULT)`, query)
+	require.Equal(t, []interface{}{"Moe", pq.Array([]string{"a"}), "larry@stooges.com", "Larry"}, args)
+
+	_, _, err = rows.insert(dialects["sqlite"], "users")
+	require.EqualError(t, err, `column "tags": array parameters are not supported by sqlite`)
+
+	_, _, err = rows.upsert(dialects["postgres"], "users", []string{"email"})
+	require.EqualError(t, err, `all rows to upsert must have the same keys [email name tags]`)
+
+	rows, ok = asMapRows([]interface{}{map[string]interface{}{"name": "Moe"}, map[string]interface{}{"email": "larry@stooges.com"}})
+	require.True(t, ok)
+	query, args, err = rows.insert(dialects["sqlite"], "users")
+	require.NoError(t, err)
+	require.Equal(t, "INSERT INTO `users` (`email`, `name`) VALUES (NULL, ?), (?, NULL)", query)
+	require.Equal(t, []interface{}{"Moe", "larry@stooges.com"}, args)
+
+	// Quoted identifiers containing "?" are not mistaken for placeholders.
+	rows, ok = asMapRows([]interface{}{map[string]interface{}{"what?": 1}})
+	require.True(t, ok)
+	query, args, err = rows.upsert(dialects["postgres"], "questions?", []string{"what?"})
+	require.NoError(t, err)
+	require.Equal(t, `INSERT INTO "questions?" ("what?") VALUES ($1) ON CONFLICT ("what?") DO UPDATE SET "what?" = EXCLUDED."what?"`,
+		strings.Join(strings.Fields(query), " "))
+	require.Equal(t, []interface{}{1}, args)
+
+	_, ok = asMapRows([]interface{}{map[string]interface{}{}, struct{}{}})
+	require.False(t, ok)
+}
+
+func TestDynamicConverters(t *testing.T) {
+	tests := []struct {
+		typeName string
+		value    interface{}
+		expected interface{}
+		err      bool
+	}{
+		{typeName: "BIGINT", value: []byte("42"), expected: int64(42)},
+		{typeName: "int4", value: int64(42), expected: int64(42)},
+		{typeName: "TINYINT", value: []byte("x"), err: true},
+		{typeName: "DOUBLE", value: []byte("1.5"), expected: 1.5},
+		{typeName: "FLOAT8", value: 1.5, expected: 1.5},
+		{typeName: "DECIMAL", value: []byte("10.50"), expected: "10.50"},
+		{typeName: "VARCHAR(255)", value: []byte("moe"), expected: "moe"},
+		{typeName: "TEXT", value: "moe", expected: "moe"},
+		{typeName: "BOOL", value: true, expected: true},
+		{typeName: "BOOLEAN", value: int64(0), expected: false},
+		{typeName: "BYTEA", value: []byte{1}, expected: []byte{1}},
+		{typeName: "POINT", value: []byte("(1,2)"), expected: "(1,2)"},
+		{typeName: "DATETIME", value: []byte("2019-01-02 03:04:05"), expected: time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{typeName: "DATE", value: []byte("2019-01-02"), expected: time.Date(2019, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{typeName: "TIMESTAMPTZ", value: time.Date(2019, 1, 2, 0, 0, 0, 0, time.UTC), expected: time.Date(2019, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{typeName: "TIMESTAMP", value: []byte("0000-00-00"), err: true},
+		{typeName: "INTEGER", value: nil, expected: nil},
+		{typeName: "_INT4", value: []byte("{1,2}"), expected: "{1,2}"},
+		{typeName: "_FLOAT8", value: []byte("{1.5}"), expected: "{1.5}"},
+		{typeName: "_TEXT", value: nil, expected: nil},
+		{typeName: "", value: []byte("raw"), expected: []byte("raw")},
+	}
+	for _, test := range tests {
+		// nolint: scopelint
+		t.Run(test.typeName, func(t *testing.T) {
+			actual, err := converterForType(test.typeName)(test.value)
+			if test.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, actual)
+		})
+	}
+}
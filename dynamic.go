@@ -0,0 +1,229 @@
+package sequel
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/alecthomas/sequel/internal/syntax"
+)
+
+var (
+	rowType    = reflect.TypeOf(Row{})
+	rowMapType = reflect.TypeOf(map[string]interface{}{})
+)
+
+// Row is a dynamically typed result row, for selecting from tables whose schema is not known at
+// compile time, eg.
+//
+// 		rows := []sequel.Row{}
+// 		err := db.Select(&rows, "SELECT * FROM " + table)
+//
+// Values are converted according to the database type of their column to one of int64, float64,
+// bool, string, time.Time, []byte or nil.
+type Row struct {
+	// Column names, in the order returned by the query.
+	Columns []string
+	Values  []interface{}
+}
+
+// Get the value of a column, and whether the column exists.
+func (r Row) Get(column string) (interface{}, bool) {
+	for i, name := range r.Columns {
+		if name == column {
+			return r.Values[i], true
+		}
+	}
+	return nil, false
+}
+
+// Map of column names to values.
+func (r Row) Map() map[string]interface{} {
+	out := make(map[string]interface{}, len(r.Columns))
+	for i, name := range r.Columns {
+		out[name] = r.Values[i]
+	}
+	return out
+}
+
+// Returns true if slice is a pointer to a slice of Row or map[string]interface{}.
+func isDynamicSlice(slice interface{}) bool {
+	t := reflect.TypeOf(slice)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Slice {
+		return false
+	}
+	elem := t.Elem().Elem()
+	return elem == rowType || elem == rowMapType
+}
+
+// Select into a slice of Row or map[string]interface{}.
+func (q *queryable) selectDynamic(slice interface{}, query string, args ...interface{}) error {
+	rows, columns, err := q.query(q.mapper, nil, query, args...)
+	if err != nil {
+		return errors.Wrapf(err, "failed to prepare select %q", query)
+	}
+	defer rows.Close()
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return errors.Wrap(err, "failed to retrieve result column types")
+	}
+	converters := make([]dynamicConverter, len(types))
+	for i, ct := range types {
+		converters[i] = converterForType(ct.DatabaseTypeName())
+	}
+	out := reflect.ValueOf(slice).Elem()
+	isMap := out.Type().Elem() == rowMapType
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		refs := make([]interface{}, len(columns))
+		for i := range values {
+			refs[i] = &values[i]
+		}
+		if err := rows.Scan(refs...); err != nil {
+			return classifyError(q.dialect, err)
+		}
+		for i, value := range values {
+			if values[i], err = converters[i](value); err != nil {
+				return errors.Wrapf(err, "column %q of type %s", columns[i], types[i].DatabaseTypeName())
+			}
+		}
+		row := Row{Columns: columns, Values: values}
+		if isMap {
+			out = reflect.Append(out, reflect.ValueOf(row.Map()))
+		} else {
+			out = reflect.Append(out, reflect.ValueOf(row))
+		}
+	}
+	reflect.ValueOf(slice).Elem().Set(out)
+	return classifyError(q.dialect, rows.Err())
+}
+
+// Converts a value scanned from the driver to a Go type.
+type dynamicConverter func(v interface{}) (interface{}, error)
+
+// Select a converter for a database type name such as "VARCHAR(255)". Arrays are returned in their
+// textual form, eg. "{1,2}", and values of unknown types are returned as-is.
+func converterForType(name string) dynamicConverter {
+	switch syntax.ClassifyType(name) {
+	case syntax.StringClass, syntax.DecimalClass, syntax.ArrayClass:
+		return nilConverter(convertString)
+	case syntax.BoolClass:
+		return nilConverter(convertBool)
+	case syntax.IntClass:
+		return nilConverter(convertInt)
+	case syntax.FloatClass:
+		return nilConverter(convertFloat)
+	case syntax.BytesClass:
+		return nilConverter(convertBytes)
+	case syntax.TimeClass:
+		return nilConverter(convertTime)
+	}
+	return func(v interface{}) (interface{}, error) { return v, nil }
+}
+
+// Wraps a converter to pass through NULL values.
+func nilConverter(convert dynamicConverter) dynamicConverter {
+	return func(v interface{}) (interface{}, error) {
+		if v == nil {
+			return nil, nil
+		}
+		return convert(v)
+	}
+}
+
+func convertString(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	}
+	return fmt.Sprint(v), nil
+}
+
+func convertBool(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case bool:
+		return v, nil
+	case int64:
+		return v != 0, nil
+	case []byte:
+		return strconv.ParseBool(string(v))
+	case string:
+		return strconv.ParseBool(v)
+	}
+	return nil, errors.Errorf("can't convert %T to bool", v)
+}
+
+func convertInt(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case int64:
+		return v, nil
+	case []byte:
+		return strconv.ParseInt(string(v), 10, 64)
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	case bool:
+		if v {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	}
+	return nil, errors.Errorf("can't convert %T to int64", v)
+}
+
+func convertFloat(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case float64:
+		return v, nil
+	case int64:
+		return float64(v), nil
+	case []byte:
+		return strconv.ParseFloat(string(v), 64)
+	case string:
+		return strconv.ParseFloat(v, 64)
+	}
+	return nil, errors.Errorf("can't convert %T to float64", v)
+}
+
+func convertBytes(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	}
+	return nil, errors.Errorf("can't convert %T to []byte", v)
+}
+
+// Layouts of textual dates and times, as returned by MySQL without "parseTime=true".
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+	"15:04:05.999999999",
+}
+
+func convertTime(v interface{}) (interface{}, error) {
+	var text string
+	switch v := v.(type) {
+	case time.Time:
+		return v, nil
+	case []byte:
+		text = string(v)
+	case string:
+		text = v
+	default:
+		return nil, errors.Errorf("can't convert %T to time.Time", v)
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, text); err == nil {
+			return t, nil
+		}
+	}
+	return nil, errors.Errorf("can't parse %q as time.Time", text)
+}
@@ -0,0 +1,185 @@
+package sequel
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// ErrorKind classifies database errors in a dialect independent way.
+type ErrorKind int
+
+// Kinds of database errors.
+const (
+	UnknownError ErrorKind = iota
+	UniqueViolation
+	ForeignKeyViolation
+	NotNullViolation
+	CheckViolation
+	Deadlock
+	SerializationFailure
+	LockTimeout
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case UniqueViolation:
+		return "unique violation"
+	case ForeignKeyViolation:
+		return "foreign key violation"
+	case NotNullViolation:
+		return "not null violation"
+	case CheckViolation:
+		return "check violation"
+	case Deadlock:
+		return "deadlock"
+	case SerializationFailure:
+		return "serialization failure"
+	case LockTimeout:
+		return "lock timeout"
+	}
+	return "unknown error"
+}
+
+// Error is a driver error normalised by the SQL dialect.
+//
+// Constraint, Table and Column are populated where the driver makes them available.
+type Error struct {
+	Kind       ErrorKind
+	Constraint string
+	Table      string
+	Column     string
+	// Err is the underlying driver error.
+	Err error
+}
+
+func (e *Error) Error() string { return fmt.Sprintf("%s: %s", e.Kind, e.Err) }
+
+// Cause returns the underlying driver error.
+func (e *Error) Cause() error { return e.Err }
+
+// Unwrap returns the underlying driver error.
+func (e *Error) Unwrap() error { return e.Err }
+
+// Retryable returns true if the failed operation may succeed if retried.
+func (e *Error) Retryable() bool {
+	switch e.Kind {
+	case Deadlock, SerializationFailure, LockTimeout:
+		return true
+	}
+	return false
+}
+
+// AsError returns the *Error in err's chain of causes, if any.
+func AsError(err error) (*Error, bool) {
+	e, ok := findCause(err, func(err error) bool {
+		_, ok := err.(*Error)
+		return ok
+	}).(*Error)
+	return e, ok
+}
+
+// Returns the first error in err's chain of causes for which match returns true, or nil.
+func findCause(err error, match func(err error) bool) error {
+	for err != nil {
+		if match(err) {
+			return err
+		}
+		switch cause := err.(type) {
+		case interface{ Cause() error }:
+			err = cause.Cause()
+		case interface{ Unwrap() error }:
+			err = cause.Unwrap()
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// A driver error found by findDriverError.
+type driverError struct {
+	v       reflect.Value
+	message string
+}
+
+// Finds the first error in err's chain of causes whose type, or the type it points to, is the struct
+// "name" declared in the package "pkgPath".
+//
+// This allows driver errors such as *mysql.MySQLError to be classified without importing the driver.
+func findDriverError(err error, pkgPath, name string) (*driverError, bool) {
+	var v reflect.Value
+	cause := findCause(err, func(err error) bool {
+		v = reflect.Indirect(reflect.ValueOf(err))
+		t := v.Type()
+		return v.Kind() == reflect.Struct && t.PkgPath() == pkgPath && t.Name() == name
+	})
+	if cause == nil {
+		return nil, false
+	}
+	return &driverError{v: v, message: cause.Error()}, true
+}
+
+// Returns the value of the integer field "name", or -1 if there is no such field.
+func (d *driverError) int(name string) int64 {
+	switch f := d.v.FieldByName(name); f.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return f.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(f.Uint())
+	}
+	return -1
+}
+
+// Returns the value of the string field "name", or "" if there is no such field.
+func (d *driverError) string(name string) string {
+	if f := d.v.FieldByName(name); f.Kind() == reflect.String {
+		return f.String()
+	}
+	return ""
+}
+
+// IsUniqueViolation returns true if err was caused by a unique or primary key constraint violation.
+func IsUniqueViolation(err error) bool { return isErrorKind(err, UniqueViolation) }
+
+// IsForeignKeyViolation returns true if err was caused by a foreign key constraint violation.
+func IsForeignKeyViolation(err error) bool { return isErrorKind(err, ForeignKeyViolation) }
+
+// IsNotNullViolation returns true if err was caused by a NOT NULL constraint violation.
+func IsNotNullViolation(err error) bool { return isErrorKind(err, NotNullViolation) }
+
+// IsCheckViolation returns true if err was caused by a CHECK constraint violation.
+func IsCheckViolation(err error) bool { return isErrorKind(err, CheckViolation) }
+
+// IsDeadlock returns true if err was caused by a deadlock.
+func IsDeadlock(err error) bool { return isErrorKind(err, Deadlock) }
+
+// IsSerializationFailure returns true if err was caused by a serialization failure.
+func IsSerializationFailure(err error) bool { return isErrorKind(err, SerializationFailure) }
+
+// IsRetryable returns true if err was caused by a transient failure such as a deadlock,
+// serialization failure or lock timeout.
+func IsRetryable(err error) bool {
+	e, ok := AsError(err)
+	return ok && e.Retryable()
+}
+
+func isErrorKind(err error, kind ErrorKind) bool {
+	e, ok := AsError(err)
+	return ok && e.Kind == kind
+}
+
+// Normalise a driver error into an *Error if the dialect recognises it.
+//
+// The *Error wraps err as-is, so any context err was wrapped with remains reachable.
+func classifyError(d dialect, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := AsError(err); ok {
+		return err
+	}
+	if e := d.ClassifyError(err); e != nil {
+		return e
+	}
+	return err
+}
@@ -10,4 +10,4 @@ require (
 	github.com/stretchr/testify v1.2.2
 )
 
-go 1.13
+go 1.16
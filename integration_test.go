@@ -149,3 +149,26 @@ func TestDialects(t *testing.T) {
 		})
 	}
 }
+
+func TestPostgresColumns(t *testing.T) {
+	db, err := Open("postgres", "dbname=sequel_test sslmode=disable")
+	require.NoError(t, err)
+	defer db.Close()
+	_, _ = db.Exec(`DROP TABLE columns_test`)
+	_, err = db.Exec(`
+		CREATE TABLE columns_test (
+			id SERIAL PRIMARY KEY,
+			name VARCHAR(128),
+			created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`)
+	require.NoError(t, err)
+	defer db.Exec(`DROP TABLE columns_test`) // nolint: errcheck
+
+	columns, err := db.Columns("columns_test")
+	require.NoError(t, err)
+	require.Equal(t, []Column{
+		{Name: "id", Type: "integer", HasDefault: true, AutoIncrement: true, PrimaryKey: true},
+		{Name: "name", Type: "character varying", Nullable: true},
+		{Name: "created", Type: "timestamp without time zone", HasDefault: true},
+	}, columns)
+}
@@ -0,0 +1,134 @@
+// Package codegen contains helpers shared by Sequel's code generators.
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+
+	"github.com/alecthomas/sequel"
+	"github.com/alecthomas/sequel/internal/syntax"
+)
+
+// Words that are capitalised in Go identifiers.
+var initialisms = map[string]bool{
+	"API": true, "DB": true, "HTML": true, "HTTP": true, "ID": true, "IP": true, "JSON": true,
+	"SQL": true, "UI": true, "URI": true, "URL": true, "UUID": true, "XML": true,
+}
+
+// GoType returns the Go type for a column, and the package it requires, if any. Nullable columns
+// are mapped to sql.Null* types, or pointers if "pointers" is true.
+func GoType(column sequel.Column, pointers bool) (t string, pkg string) {
+	t = ScalarType(column.Type)
+	switch {
+	case t == "[]byte" || t == "interface{}" || !column.Nullable:
+		return t, pkgOf(t)
+	case pointers:
+		return "*" + t, pkgOf(t)
+	}
+	switch t {
+	case "int64":
+		return "sql.NullInt64", "database/sql"
+	case "float64":
+		return "sql.NullFloat64", "database/sql"
+	case "bool":
+		return "sql.NullBool", "database/sql"
+	case "string":
+		return "sql.NullString", "database/sql"
+	case "time.Time":
+		return "sql.NullTime", "database/sql"
+	}
+	return t, pkgOf(t)
+}
+
+func pkgOf(t string) string {
+	if strings.HasPrefix(t, "time.") {
+		return "time"
+	}
+	return ""
+}
+
+// ScalarType maps a database column type to a non-nullable Go type, classifying it as dynamic rows do.
+// Decimals and arrays are mapped to strings, to avoid loss of precision. "interface{}" is returned for
+// unrecognised types.
+func ScalarType(columnType string) string {
+	switch syntax.ClassifyType(columnType) {
+	case syntax.StringClass, syntax.DecimalClass, syntax.ArrayClass:
+		return "string"
+	case syntax.BoolClass:
+		return "bool"
+	case syntax.IntClass:
+		return "int64"
+	case syntax.FloatClass:
+		return "float64"
+	case syntax.BytesClass:
+		return "[]byte"
+	case syntax.TimeClass:
+		return "time.Time"
+	}
+	return "interface{}"
+}
+
+// GoName converts a table or column name to an exported Go identifier, eg. "user_id" to "UserID".
+func GoName(name string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	out := &strings.Builder{}
+	for _, word := range words {
+		upper := strings.ToUpper(word)
+		if initialisms[upper] {
+			out.WriteString(upper)
+			continue
+		}
+		runes := []rune(word)
+		out.WriteRune(unicode.ToUpper(runes[0]))
+		out.WriteString(string(runes[1:]))
+	}
+	if out.Len() == 0 || unicode.IsDigit([]rune(out.String())[0]) {
+		return "X" + out.String()
+	}
+	return out.String()
+}
+
+// Write a formatted Go source file to w, consisting of a header, the package clause, imports and body.
+func Write(w io.Writer, command, pkg string, imports map[string]bool, body []byte) error {
+	out := &bytes.Buffer{}
+	fmt.Fprintf(out, "// Code generated by %s. DO NOT EDIT.\n\npackage %s\n", command, pkg)
+	if len(imports) > 0 {
+		pkgs := make([]string, 0, len(imports))
+		for pkg := range imports {
+			pkgs = append(pkgs, pkg)
+		}
+		// Standard library packages first, as goimports would.
+		sort.Slice(pkgs, func(i, j int) bool {
+			if isStd(pkgs[i]) != isStd(pkgs[j]) {
+				return isStd(pkgs[i])
+			}
+			return pkgs[i] < pkgs[j]
+		})
+		fmt.Fprintf(out, "\nimport (\n")
+		for i, pkg := range pkgs {
+			if i > 0 && isStd(pkgs[i-1]) && !isStd(pkg) {
+				fmt.Fprintf(out, "\n")
+			}
+			fmt.Fprintf(out, "\t%q\n", pkg)
+		}
+		fmt.Fprintf(out, ")\n")
+	}
+	out.Write(body)
+	source, err := format.Source(out.Bytes())
+	if err != nil {
+		return errors.Wrap(err, "failed to format generated code")
+	}
+	_, err = w.Write(source)
+	return err
+}
+
+func isStd(pkg string) bool {
+	return !strings.Contains(strings.SplitN(pkg, "/", 2)[0], ".")
+}
@@ -0,0 +1,74 @@
+// Package syntax contains the query tokenizer, struct tag parser and column type classifier shared by
+// Sequel and its tools.
+package syntax
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Lexer tokenizes queries. Submatches are, in order: "?" placeholders, the table qualifying a
+// "t.**" wildcard, "**" wildcards, the alias of a "**(alias)" wildcard, "*", double, single and
+// backtick quoted strings, and other text.
+//
+// Words are matched individually so that a word followed by ".**" is matched as a qualifier.
+var Lexer = regexp.MustCompile(
+	"(\\?)|" +
+		"(?:(\\w+)\\.)?(\\*\\*)(?:\\((\\w+)\\))?|" +
+		"(\\*)|" +
+		"(\"(?:\\.|[^\"])*\")|" +
+		"('(?:\\.|[^'])*')|" +
+		"(`(?:\\.|[^`])*`)|" +
+		"(\\w+|[^$*?\"'`\\w]+)")
+
+// Placeholders returns the number of "?" placeholders in query.
+func Placeholders(query string) int {
+	count := 0
+	for _, match := range Lexer.FindAllStringSubmatch(query, -1) {
+		if match[1] == "?" {
+			count++
+		}
+	}
+	return count
+}
+
+// Tag is a parsed "db" struct tag.
+type Tag struct {
+	// Name of the column, or "" to derive it from the field name.
+	Name    string
+	Managed bool
+	PK      bool
+	Prefix  bool
+	JSON    bool
+	Array   bool
+	UUID    bool
+}
+
+// ParseTag parses the value of a "db" struct tag, eg. "id,pk,managed".
+//
+// Whether options are valid for the type of the field is not checked.
+func ParseTag(tag string) (Tag, error) {
+	parts := strings.Split(tag, ",")
+	out := Tag{Name: parts[0]}
+	for _, part := range parts[1:] {
+		switch part {
+		case "managed":
+			out.Managed = true
+		case "pk":
+			out.PK = true
+		case "prefix":
+			out.Prefix = true
+		case "json":
+			out.JSON = true
+		case "array":
+			out.Array = true
+		case "uuid":
+			out.UUID = true
+		default:
+			return Tag{}, errors.Errorf("invalid tag attribute %q", part)
+		}
+	}
+	return out, nil
+}
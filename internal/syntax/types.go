@@ -0,0 +1,64 @@
+package syntax
+
+import (
+	"strings"
+)
+
+// TypeClass is the class of a database column type, as determined by ClassifyType.
+type TypeClass int
+
+// Classes of database column types.
+const (
+	UnknownClass TypeClass = iota
+	StringClass
+	DecimalClass
+	BoolClass
+	IntClass
+	FloatClass
+	BytesClass
+	TimeClass
+	ArrayClass
+)
+
+// ClassifyType classifies a database type name such as "VARCHAR(255)".
+//
+// As database type names differ between dialects, types are matched by substring, in a similar
+// fashion to SQLite's type affinity rules. Postgres array types are named for their element type
+// prefixed with "_", eg. "_INT4", and MySQL's "TINYINT(1)" is a boolean.
+func ClassifyType(name string) TypeClass {
+	name = strings.ToUpper(name)
+	if strings.HasPrefix(name, "_") {
+		return ArrayClass
+	}
+	if strings.HasPrefix(name, "TINYINT(1)") {
+		return BoolClass
+	}
+	if i := strings.Index(name, "("); i >= 0 {
+		name = name[:i]
+	}
+	contains := func(substrs ...string) bool {
+		for _, substr := range substrs {
+			if strings.Contains(name, substr) {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case contains("DEC", "NUMERIC", "MONEY"):
+		return DecimalClass
+	case name == "SET" || contains("INTERVAL", "POINT", "CHAR", "CLOB", "TEXT", "STRING", "JSON", "UUID", "ENUM"):
+		return StringClass
+	case contains("BOOL"):
+		return BoolClass
+	case contains("INT", "SERIAL", "YEAR"):
+		return IntClass
+	case contains("REAL", "FLOA", "DOUB"):
+		return FloatClass
+	case contains("BLOB", "BINARY", "BYTEA"):
+		return BytesClass
+	case contains("DATE", "TIME"):
+		return TimeClass
+	}
+	return UnknownClass
+}
@@ -0,0 +1,321 @@
+package sequel
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// JSONEncoder marshals and unmarshals fields tagged with "json".
+type JSONEncoder interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// WithJSONEncoder overrides the encoder used for fields tagged with "json". Defaults to encoding/json.
+func WithJSONEncoder(encoder JSONEncoder) Option {
+	return func(db *DB) { db.mapper.json = encoder }
+}
+
+type stdJSONEncoder struct{}
+
+func (stdJSONEncoder) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (stdJSONEncoder) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+var (
+	codecs    = map[reflect.Type]*codec{}
+	codecGen  int
+	codecLock sync.RWMutex
+)
+
+type codec struct {
+	encode func(v interface{}) (driver.Value, error)
+	decode func(src interface{}, dest interface{}) error
+}
+
+// RegisterCodec registers functions to bind and scan values of type t, for types that do not
+// implement driver.Valuer and sql.Scanner, eg. net.IP or url.URL.
+//
+// "encode" is passed a value of type t and must return a driver.Value. "decode" is passed the
+// value returned by the driver and a pointer to a value of type t to populate. Fields and
+// arguments of type t, or pointers to t, will use the codec. Nil pointers are bound as NULL,
+// and NULL is scanned as a nil pointer or zero value.
+func RegisterCodec(t reflect.Type, encode func(v interface{}) (driver.Value, error), decode func(src interface{}, dest interface{}) error) {
+	codecLock.Lock()
+	codecs[t] = &codec{encode: encode, decode: decode}
+	codecGen++
+	codecLock.Unlock()
+}
+
+// Incremented whenever a codec is registered, invalidating cached row builders.
+func codecGeneration() int {
+	codecLock.RLock()
+	defer codecLock.RUnlock()
+	return codecGen
+}
+
+// Find the codec for t or *t.
+func lookupCodec(t reflect.Type) *codec {
+	codecLock.RLock()
+	defer codecLock.RUnlock()
+	if c, ok := codecs[t]; ok {
+		return c
+	}
+	if t.Kind() == reflect.Ptr {
+		return codecs[t.Elem()]
+	}
+	return nil
+}
+
+func (c *codec) encodeValue(v reflect.Value) (interface{}, error) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+	return c.encode(v.Interface())
+}
+
+// Decodes a column with a registered codec.
+type codecScanner struct {
+	codec *codec
+	field string
+	dest  reflect.Value
+}
+
+func (c *codecScanner) Scan(src interface{}) error {
+	if src == nil {
+		c.dest.Set(reflect.Zero(c.dest.Type()))
+		return nil
+	}
+	dest := c.dest
+	if dest.Kind() == reflect.Ptr {
+		dest.Set(reflect.New(dest.Type().Elem()))
+		dest = dest.Elem()
+	}
+	return errors.Wrapf(c.codec.decode(src, dest.Addr().Interface()), "failed to decode field %s", c.field)
+}
+
+// A NameMapper maps a Go struct field name to a column name. It is only used for fields without
+// an explicit name in their "db" tag.
+type NameMapper func(fieldName string) string
+
+// WithNameMapper sets how struct field names are mapped to column names. Defaults to SnakeCaseMapper.
+//
+// Mappers can be composed, eg. for UPPER_SNAKE columns:
+//
+// 		sequel.WithNameMapper(func(name string) string {
+// 			return strings.ToUpper(sequel.SnakeCaseMapper(name))
+// 		})
+func WithNameMapper(names NameMapper) Option {
+	return func(db *DB) { db.mapper.names = names }
+}
+
+// SnakeCaseMapper maps field names to lower snake case, eg. "UserID" to "user_id".
+func SnakeCaseMapper(name string) string {
+	return strings.ToLower(strings.Join(camelCase(name), "_"))
+}
+
+// CamelCaseMapper maps field names to lower camel case, eg. "UserID" to "userId".
+func CamelCaseMapper(name string) string {
+	w := &strings.Builder{}
+	for i, word := range camelCase(name) {
+		word = strings.ToLower(word)
+		if i > 0 && word != "" {
+			word = strings.ToUpper(word[:1]) + word[1:]
+		}
+		w.WriteString(word)
+	}
+	return w.String()
+}
+
+// IdentityMapper maps field names to identically named columns.
+func IdentityMapper(name string) string {
+	return name
+}
+
+// A mapper holds a DB's configuration for mapping between Go and SQL values, and caches the
+// row builders created with that configuration.
+type mapper struct {
+	json   JSONEncoder
+	names  NameMapper
+	schema *schema
+	// If set, row builders only include fields with a column in this table. See forTable.
+	table string
+	cache *builderCache
+}
+
+// Cache of row builders.
+type builderCache struct {
+	lock       sync.RWMutex
+	builders   map[reflect.Type]*builder
+	generation int
+}
+
+func newMapper() *mapper {
+	return &mapper{
+		json:  stdJSONEncoder{},
+		names: SnakeCaseMapper,
+		cache: &builderCache{builders: map[reflect.Type]*builder{}},
+	}
+}
+
+// ArrayValue is a slice that is bound as a single array parameter. See Array.
+type ArrayValue struct {
+	Slice interface{}
+}
+
+// Array wraps a slice so that it is bound as a single array parameter, eg. for "id = ANY(?)", rather
+// than being expanded into a list of parameters. It can also be passed to Scan to scan an array
+// column into a pointer to a slice.
+//
+// Arrays are only supported by PostgreSQL. Slices of string, int64, float64, bool and []byte are supported.
+func Array(slice interface{}) ArrayValue {
+	return ArrayValue{Slice: slice}
+}
+
+// Scan implements sql.Scanner.
+func (a ArrayValue) Scan(src interface{}) error {
+	return pq.Array(a.Slice).Scan(src)
+}
+
+// Convert a field value to the value bound to its placeholder.
+func (m *mapper) encodeField(d dialect, field field, v reflect.Value) (interface{}, error) {
+	if field.codec != nil {
+		return field.codec.encodeValue(v)
+	}
+	if field.array {
+		return d.Array(v.Interface())
+	}
+	if field.uuid {
+		return formatUUID(byteArray(v)), nil
+	}
+	if isByteArrayType(field.t) {
+		return byteArray(v), nil
+	}
+	if field.json {
+		if isNil(v) {
+			return nil, nil
+		}
+		data, err := m.json.Marshal(v.Interface())
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to encode field %s as JSON", field.name)
+		}
+		return string(data), nil
+	}
+	return v.Interface(), nil
+}
+
+// Returns the destination passed to sql.Rows.Scan(...) for a field.
+func (m *mapper) fieldScanner(field field, v reflect.Value) interface{} {
+	if field.codec != nil {
+		return &codecScanner{codec: field.codec, field: field.name, dest: v}
+	}
+	if field.json {
+		return &jsonScanner{encoder: m.json, field: field.name, dest: v}
+	}
+	if field.array {
+		return pq.Array(v.Addr().Interface())
+	}
+	if isByteArrayType(field.t) {
+		return &byteArrayScanner{field: field.name, uuid: field.uuid, dest: v}
+	}
+	return v.Addr().Interface()
+}
+
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
+
+// Unmarshals a JSON column into a field.
+type jsonScanner struct {
+	encoder JSONEncoder
+	field   string
+	dest    reflect.Value
+}
+
+func (j *jsonScanner) Scan(src interface{}) error {
+	var data []byte
+	switch src := src.(type) {
+	case nil:
+		j.dest.Set(reflect.Zero(j.dest.Type()))
+		return nil
+	case []byte:
+		data = src
+	case string:
+		data = []byte(src)
+	default:
+		return errors.Errorf("can't decode %T as JSON into field %s", src, j.field)
+	}
+	return errors.Wrapf(j.encoder.Unmarshal(data, j.dest.Addr().Interface()), "failed to decode JSON into field %s", j.field)
+}
+
+func isByteArrayType(t reflect.Type) bool {
+	return t.Kind() == reflect.Array && t.Elem().Kind() == reflect.Uint8
+}
+
+// Copy a fixed-size byte array into a slice.
+func byteArray(v reflect.Value) []byte {
+	out := make([]byte, v.Len())
+	reflect.Copy(reflect.ValueOf(out), v)
+	return out
+}
+
+func formatUUID(b []byte) string {
+	s := hex.EncodeToString(b)
+	return s[:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
+
+func parseUUID(s string) ([]byte, error) {
+	b, err := hex.DecodeString(strings.Replace(s, "-", "", -1))
+	if err != nil || len(b) != 16 {
+		return nil, errors.Errorf("invalid UUID %q", s)
+	}
+	return b, nil
+}
+
+// Scans BLOB, bytea or UUID columns into fixed-size byte arrays.
+type byteArrayScanner struct {
+	field string
+	uuid  bool
+	dest  reflect.Value
+}
+
+func (b *byteArrayScanner) Scan(src interface{}) error {
+	var data []byte
+	switch src := src.(type) {
+	case nil:
+		b.dest.Set(reflect.Zero(b.dest.Type()))
+		return nil
+	case []byte:
+		data = src
+	case string:
+		data = []byte(src)
+	default:
+		return errors.Errorf("can't scan %T into field %s", src, b.field)
+	}
+	// UUIDs may be returned in text form.
+	if b.uuid && len(data) != b.dest.Len() {
+		var err error
+		data, err = parseUUID(string(data))
+		if err != nil {
+			return errors.Wrapf(err, "field %s", b.field)
+		}
+	}
+	if len(data) != b.dest.Len() {
+		return errors.Errorf("can't scan %d bytes into field %s of type %s", len(data), b.field, b.dest.Type())
+	}
+	reflect.Copy(b.dest, reflect.ValueOf(data))
+	return nil
+}
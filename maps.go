@@ -0,0 +1,140 @@
+package sequel
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Rows of maps of column names to values to insert or upsert, eg. for user-defined columns.
+type mapRows struct {
+	// Sorted union of the keys of all rows.
+	columns []string
+	rows    []map[string]interface{}
+}
+
+// Returns rows as mapRows if they are a single slice of maps, or a sequence of maps.
+func asMapRows(rows []interface{}) (*mapRows, bool) {
+	out := &mapRows{}
+	if len(rows) == 1 {
+		switch row := rows[0].(type) {
+		case []map[string]interface{}:
+			out.rows = row
+		case map[string]interface{}:
+			out.rows = []map[string]interface{}{row}
+		default:
+			return nil, false
+		}
+	} else {
+		for _, row := range rows {
+			m, ok := row.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			out.rows = append(out.rows, m)
+		}
+	}
+	seen := map[string]bool{}
+	for _, row := range out.rows {
+		for column := range row {
+			if !seen[column] {
+				seen[column] = true
+				out.columns = append(out.columns, column)
+			}
+		}
+	}
+	sort.Strings(out.columns)
+	return out, true
+}
+
+// A builder with a field per column, for constructing statements with the dialect.
+func (r *mapRows) builder() *builder {
+	out := &builder{t: rowMapType, fields: r.columns, fieldMap: map[string]field{}}
+	for _, column := range r.columns {
+		out.fieldMap[column] = field{name: column, column: column}
+	}
+	return out
+}
+
+// Construct a VALUES list for the rows, eg. "(?, ?), (?, DEFAULT)".
+//
+// Columns missing from a row are set to the dialect's default value. Unlike the fields of structs,
+// values are bound as-is rather than expanded, other than values with a registered codec and arrays.
+func (r *mapRows) values(d dialect) (string, []interface{}, error) {
+	if len(r.rows) == 0 {
+		return "", nil, errors.New("no rows to insert")
+	}
+	if len(r.columns) == 0 {
+		return "", nil, errors.New("no columns to insert")
+	}
+	w := &strings.Builder{}
+	args := []interface{}{}
+	for i, row := range r.rows {
+		if i > 0 {
+			w.WriteString(", ")
+		}
+		w.WriteString("(")
+		for j, column := range r.columns {
+			if j > 0 {
+				w.WriteString(", ")
+			}
+			value, ok := row[column]
+			if !ok {
+				w.WriteString(d.Default())
+				continue
+			}
+			value, err := encodeMapValue(d, value)
+			if err != nil {
+				return "", nil, errors.Wrapf(err, "column %q", column)
+			}
+			w.WriteString(d.Placeholder(len(args)))
+			args = append(args, value)
+		}
+		w.WriteString(")")
+	}
+	return w.String(), args, nil
+}
+
+// Construct an INSERT statement for the rows.
+func (r *mapRows) insert(d dialect, table string) (string, []interface{}, error) {
+	values, args, err := r.values(d)
+	if err != nil {
+		return "", nil, err
+	}
+	// nolint: gosec
+	query := fmt.Sprintf(`INSERT INTO %s (%s) VALUES %s`, d.QuoteID(table), quoteAndJoinIDs(d.QuoteID, r.columns), values)
+	return query, args, nil
+}
+
+// Construct an upsert statement for the rows. Only the columns of the rows are updated.
+//
+// Every row must have the same keys, as default values for missing columns would overwrite the
+// values of existing rows.
+func (r *mapRows) upsert(d dialect, table string, keys []string) (string, []interface{}, error) {
+	for _, row := range r.rows {
+		if len(row) != len(r.columns) {
+			return "", nil, errors.Errorf("all rows to upsert must have the same keys %v", r.columns)
+		}
+	}
+	values, args, err := r.values(d)
+	if err != nil {
+		return "", nil, err
+	}
+	return d.Upsert(table, keys, r.builder(), values), args, nil
+}
+
+func encodeMapValue(d dialect, value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	if codec := lookupCodec(reflect.TypeOf(value)); codec != nil {
+		return codec.encodeValue(reflect.ValueOf(value))
+	}
+	if array, ok := value.(ArrayValue); ok {
+		return d.Array(array.Slice)
+	}
+	return value, nil
+}
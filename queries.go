@@ -0,0 +1,232 @@
+package sequel
+
+import (
+	"bufio"
+	"database/sql"
+	"io"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var queryNameRegex = regexp.MustCompile(`^--\s*name:\s*(\S*)\s*(\S*)\s*$`)
+
+// QueryKind is the kind of result a named query returns.
+type QueryKind string
+
+// Kinds of named queries.
+const (
+	QueryOne  QueryKind = ":one"
+	QueryMany QueryKind = ":many"
+	QueryExec QueryKind = ":exec"
+)
+
+// NamedQuery is an SQL statement annotated with a name and kind, eg.
+//
+// 		-- name: FindUsersByGroup :many
+// 		SELECT ** FROM users WHERE group_id = ?
+type NamedQuery struct {
+	Name string
+	Kind QueryKind
+	SQL  string
+	// Source file and line of the annotation.
+	File string
+	Line int
+}
+
+// ParseQueries parses named queries from SQL.
+//
+// Each query starts with an annotation of the form "-- name: <Name> <:one|:many|:exec>" and ends at
+// the next annotation. Trailing semicolons are removed. Only comments and blank lines may precede
+// the first annotation.
+func ParseQueries(r io.Reader, filename string) ([]NamedQuery, error) {
+	out := []NamedQuery{}
+	seen := map[string]bool{}
+	var (
+		query *NamedQuery
+		body  []string
+	)
+	flush := func() error {
+		if query == nil {
+			return nil
+		}
+		query.SQL = strings.TrimRight(strings.TrimSpace(strings.Join(body, "\n")), ";")
+		if strings.TrimSpace(query.SQL) == "" {
+			return errors.Errorf("%s:%d: query %s is empty", filename, query.Line, query.Name)
+		}
+		out = append(out, *query)
+		return nil
+	}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		trimmed := strings.TrimSpace(text)
+		groups := queryNameRegex.FindStringSubmatch(trimmed)
+		if groups == nil {
+			if query == nil && trimmed != "" && !strings.HasPrefix(trimmed, "--") {
+				return nil, errors.Errorf("%s:%d: SQL must be preceded by a \"-- name:\" annotation", filename, line)
+			}
+			body = append(body, text)
+			continue
+		}
+		if err := flush(); err != nil {
+			return nil, err
+		}
+		name, kind := groups[1], QueryKind(groups[2])
+		if name == "" {
+			return nil, errors.Errorf("%s:%d: query name is missing", filename, line)
+		}
+		switch kind {
+		case QueryOne, QueryMany, QueryExec:
+		default:
+			return nil, errors.Errorf("%s:%d: query %s must be of kind :one, :many or :exec, not %q", filename, line, name, kind)
+		}
+		if seen[name] {
+			return nil, errors.Errorf("%s:%d: duplicate query %s", filename, line, name)
+		}
+		seen[name] = true
+		query = &NamedQuery{Name: name, Kind: kind, File: filename, Line: line}
+		body = nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", filename)
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Queries is a registry of named queries, loaded with LoadQueries.
+type Queries struct {
+	queries map[string]NamedQuery
+}
+
+// LoadQueries parses the named queries in each file in fsys matching the glob pattern, eg. from an
+// embed.FS. See ParseQueries for the file format.
+//
+// Each query is validated to ensure it is fully understood by Sequel's tokenizer. Query names must
+// be unique across all files.
+func LoadQueries(fsys fs.FS, pattern string) (*Queries, error) {
+	paths, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid pattern %q", pattern)
+	}
+	if len(paths) == 0 {
+		return nil, errors.Errorf("no files match %q", pattern)
+	}
+	sort.Strings(paths)
+	out := &Queries{queries: map[string]NamedQuery{}}
+	for _, path := range paths {
+		queries, err := parseQueryFile(fsys, path)
+		if err != nil {
+			return nil, err
+		}
+		for _, query := range queries {
+			if existing, ok := out.queries[query.Name]; ok {
+				return nil, errors.Errorf("%s:%d: query %s is already defined at %s:%d",
+					query.File, query.Line, query.Name, existing.File, existing.Line)
+			}
+			if err := lexQuery(query.SQL); err != nil {
+				return nil, errors.Wrapf(err, "%s:%d: query %s", query.File, query.Line, query.Name)
+			}
+			out.queries[query.Name] = query
+		}
+	}
+	return out, nil
+}
+
+func parseQueryFile(fsys fs.FS, path string) ([]NamedQuery, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseQueries(f, path)
+}
+
+// Get a named query.
+func (q *Queries) Get(name string) (NamedQuery, bool) {
+	query, ok := q.queries[name]
+	return query, ok
+}
+
+// Names of all queries, sorted.
+func (q *Queries) Names() []string {
+	out := make([]string, 0, len(q.queries))
+	for name := range q.queries {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Check that the tokens matched by the lexer cover the entire query. Any text that is not matched,
+// such as an unterminated quote, would otherwise be silently dropped by expansion.
+func lexQuery(query string) error {
+	offset := 0
+	for _, match := range lexerRegex.FindAllStringIndex(query, -1) {
+		if match[0] != offset {
+			break
+		}
+		offset = match[1]
+	}
+	if offset != len(query) {
+		return errors.Errorf("unexpected %q at offset %d", query[offset:offset+1], offset)
+	}
+	return nil
+}
+
+// WithQueries sets the registry of named queries used by SelectNamed, SelectOneNamed and ExecNamed.
+func WithQueries(queries *Queries) Option {
+	return func(db *DB) { db.queries = queries }
+}
+
+// Lookup the SQL of a named query.
+func (q *queryable) namedQuery(name string) (string, error) {
+	if q.queries == nil {
+		return "", errors.Errorf("can't execute named query %s, no queries were provided with WithQueries()", name)
+	}
+	query, ok := q.queries.Get(name)
+	if !ok {
+		return "", errors.Errorf("unknown named query %s", name)
+	}
+	return query.SQL, nil
+}
+
+// SelectNamed is like Select, but executes the query registered with WithQueries under "name".
+func (q *queryable) SelectNamed(slice interface{}, name string, args ...interface{}) error {
+	query, err := q.namedQuery(name)
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(q.Select(slice, query, args...), name)
+}
+
+// SelectOneNamed is like SelectOne, but executes the query registered with WithQueries under "name".
+func (q *queryable) SelectOneNamed(ref interface{}, name string, args ...interface{}) error {
+	query, err := q.namedQuery(name)
+	if err != nil {
+		return err
+	}
+	err = q.SelectOne(ref, query, args...)
+	if err == sql.ErrNoRows {
+		return err
+	}
+	return errors.Wrap(err, name)
+}
+
+// ExecNamed is like Exec, but executes the query registered with WithQueries under "name".
+func (q *queryable) ExecNamed(name string, args ...interface{}) (sql.Result, error) {
+	query, err := q.namedQuery(name)
+	if err != nil {
+		return nil, err
+	}
+	result, err := q.Exec(query, args...)
+	return result, errors.Wrap(err, name)
+}
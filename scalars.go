@@ -0,0 +1,174 @@
+package sequel
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Returns true if values of t are scanned from a single column, ie. basic types, byte slices and
+// arrays, time.Time, sql.Scanner implementations, types with a registered codec, and pointers to
+// any of these.
+func isScalarType(t reflect.Type) bool {
+	if lookupCodec(t) != nil || t == timeType || t == byteSliceType || isByteArrayType(t) ||
+		t.Implements(scannerType) || reflect.PtrTo(t).Implements(scannerType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Ptr:
+		return isScalarType(t.Elem())
+	}
+	return false
+}
+
+// Returns true if slice is a pointer to a slice of scalars.
+func isScalarSlice(slice interface{}) bool {
+	t := reflect.TypeOf(slice)
+	return t != nil && t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Slice && isScalarType(t.Elem().Elem())
+}
+
+// Returns a value suitable for sql.Rows.Scan(...) that scans a column into v.
+func (m *mapper) scalarScanner(column string, v reflect.Value) interface{} {
+	return m.fieldScanner(field{name: column, t: v.Type(), codec: lookupCodec(v.Type())}, v)
+}
+
+// Select a single column into a slice of scalars.
+func (q *queryable) selectScalars(slice interface{}, query string, args ...interface{}) error {
+	rows, columns, err := q.query(q.mapper, nil, query, args...)
+	if err != nil {
+		return errors.Wrapf(err, "failed to prepare select %q", query)
+	}
+	defer rows.Close()
+	if len(columns) != 1 {
+		return errors.Errorf("can only select a single column into %T, not (%s)", slice, strings.Join(columns, ", "))
+	}
+	out := reflect.ValueOf(slice).Elem()
+	for rows.Next() {
+		el := reflect.New(out.Type().Elem()).Elem()
+		if err := rows.Scan(q.mapper.scalarScanner(columns[0], el)); err != nil {
+			return classifyError(q.dialect, err)
+		}
+		out = reflect.Append(out, el)
+	}
+	reflect.ValueOf(slice).Elem().Set(out)
+	return classifyError(q.dialect, rows.Err())
+}
+
+// SelectMap issues a query and collects the returned rows into "ref", which must be a pointer to a
+// map. A nil map will be allocated.
+//
+// If the values of the map are structs, or pointers to structs, each row is mapped as if by Select
+// and keyed by the struct's "pk" field, or by the field of the first column if the "pk" field is not
+// selected. Otherwise the query must return two columns, the key and the value, eg.
+//
+// 		counts := map[string]int{}
+// 		err := db.SelectMap(&counts, "SELECT name, COUNT(*) FROM users GROUP BY name")
+//
+// An error is returned if a key occurs more than once.
+func (q *queryable) SelectMap(ref interface{}, query string, args ...interface{}) error {
+	t := reflect.TypeOf(ref)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Map {
+		return errors.Errorf("expected a pointer to a map but got %T", ref)
+	}
+	out := reflect.ValueOf(ref).Elem()
+	if out.IsNil() {
+		out.Set(reflect.MakeMap(out.Type()))
+	}
+	elem := t.Elem().Elem()
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	if elem.Kind() == reflect.Struct && !isScalarType(elem) {
+		return q.selectStructMap(out, query, args...)
+	}
+	return q.selectScalarMap(out, query, args...)
+}
+
+// Select key and value columns into a map.
+func (q *queryable) selectScalarMap(out reflect.Value, query string, args ...interface{}) error {
+	rows, columns, err := q.query(q.mapper, nil, query, args...)
+	if err != nil {
+		return errors.Wrapf(err, "failed to prepare select %q", query)
+	}
+	defer rows.Close()
+	if len(columns) != 2 {
+		return errors.Errorf("can only select key and value columns into %s, not (%s)", out.Type(), strings.Join(columns, ", "))
+	}
+	for rows.Next() {
+		key := reflect.New(out.Type().Key()).Elem()
+		value := reflect.New(out.Type().Elem()).Elem()
+		if err := rows.Scan(q.mapper.scalarScanner(columns[0], key), q.mapper.scalarScanner(columns[1], value)); err != nil {
+			return classifyError(q.dialect, err)
+		}
+		if err := setMapIndex(out, key, value); err != nil {
+			return err
+		}
+	}
+	return classifyError(q.dialect, rows.Err())
+}
+
+// Select rows into a map of structs, keyed by their PK or first column.
+func (q *queryable) selectStructMap(out reflect.Value, query string, args ...interface{}) error {
+	m, err := q.mapper.forQuery(q.db, q.dialect, query)
+	if err != nil {
+		return err
+	}
+	builder, err := m.makeRowBuilderForType(out.Type().Elem())
+	if err != nil {
+		return errors.Wrapf(err, "failed to map %s", out.Type())
+	}
+	rows, columns, mapping, err := q.prepareSelect(m, builder, query, args...)
+	if err != nil {
+		return errors.Wrapf(err, "failed to prepare select %q", query)
+	}
+	defer rows.Close()
+	if len(columns) == 0 {
+		return errors.New("no columns to key rows by")
+	}
+	key := columns[0]
+	for _, column := range columns {
+		if builder.pk != "" && column == builder.pk {
+			key = column
+		}
+	}
+	keyField, ok := builder.fieldMap[key]
+	if !ok {
+		return errors.Errorf("no field maps to key column %q", key)
+	}
+	keyType := out.Type().Key()
+	if !keyField.t.ConvertibleTo(keyType) {
+		return errors.Errorf("can't key %s by field %s of type %s", out.Type(), key, keyField.t)
+	}
+	addrElem := out.Type().Elem().Kind() == reflect.Ptr
+	for rows.Next() {
+		el := reflect.New(builder.t).Elem()
+		if err := builder.scan(m, rows, el, columns); err != nil {
+			return errors.Wrap(classifyError(q.dialect, err), mapping)
+		}
+		k, ok := fieldByIndex(el, keyField.index)
+		if !ok {
+			return errors.Errorf("key column %q is NULL", key)
+		}
+		if addrElem {
+			el = el.Addr()
+		}
+		if err := setMapIndex(out, k.Convert(keyType), el); err != nil {
+			return err
+		}
+	}
+	return classifyError(q.dialect, rows.Err())
+}
+
+func setMapIndex(m, key, value reflect.Value) error {
+	if m.MapIndex(key).IsValid() {
+		return errors.Errorf("duplicate key %v", key.Interface())
+	}
+	m.SetMapIndex(key, value)
+	return nil
+}
@@ -0,0 +1,295 @@
+package sequel
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/alecthomas/sequel/internal/syntax"
+)
+
+// Matches candidates for the table targeted by a statement, eg. "SELECT ** FROM users" or
+// "INSERT INTO public.users". See targetTable.
+var targetTableRegex = regexp.MustCompile(`(?i)\b(?:FROM|INTO|UPDATE)\s+((?:[` + "`" + `"]?\w+[` + "`" + `"]?\.)?[` + "`" + `"]?\w+)`)
+
+// Returns the possibly schema-qualified table targeted by query, or "" if there is none.
+//
+// FROM clauses nested in parentheses, such as subqueries or "EXTRACT(YEAR FROM created)", are
+// skipped.
+func targetTable(query string) string {
+	for _, match := range targetTableRegex.FindAllStringSubmatchIndex(query, -1) {
+		prefix := query[:match[0]]
+		if strings.Count(prefix, "(") != strings.Count(prefix, ")") {
+			continue
+		}
+		return strings.NewReplacer("`", "", `"`, "").Replace(query[match[2]:match[3]])
+	}
+	return ""
+}
+
+// Splits a table name that may be qualified with a schema, eg. "public.users", into its schema
+// and name. The schema is "" if the table is not qualified.
+func splitTableName(table string) (schema, name string) {
+	if dot := strings.LastIndex(table, "."); dot >= 0 {
+		return table[:dot], table[dot+1:]
+	}
+	return "", table
+}
+
+// Column of a database table.
+type Column struct {
+	Name          string
+	Type          string // As reported by the database, eg. "varchar(255)".
+	Nullable      bool
+	HasDefault    bool
+	AutoIncrement bool
+	PrimaryKey    bool
+}
+
+// WithSchemaIntrospection enables schema-aware mapping.
+//
+// The columns of the table targeted by a statement (ie. by FROM, INTO or UPDATE), or by Insert or
+// Upsert, are introspected once and cached. "**" expansion, Insert and Upsert then only include
+// fields that have a corresponding column, so that fields can be added to code before the DDL adding
+// their columns is applied. Other selected columns, eg. aliases and aggregates, are mapped as usual,
+// and fields without a corresponding column may be missing from results.
+//
+// "warn", if not nil, is called once for each field of a type that has no column in a table.
+//
+// Tables that do not exist, eg. views or CTEs, are not restricted, and are introspected again on
+// each use in case they have since been created.
+//
+// Fields of nested structs are not filtered.
+func WithSchemaIntrospection(warn func(table, field string)) Option {
+	return func(db *DB) {
+		db.mapper.schema = &schema{
+			warn:     warn,
+			tables:   map[string]map[string]bool{},
+			builders: map[schemaKey]*builder{},
+		}
+	}
+}
+
+type schemaKey struct {
+	builder *builder
+	table   string
+}
+
+// Cache of introspected table columns, and of row builders restricted to those columns.
+type schema struct {
+	warn     func(table, field string)
+	lock     sync.Mutex
+	tables   map[string]map[string]bool
+	builders map[schemaKey]*builder
+}
+
+// Returns the set of columns in table, introspecting it if necessary. The set is empty, and not
+// cached, if the table does not exist.
+func (s *schema) columns(ops sqlOps, d dialect, table string) (map[string]bool, error) {
+	s.lock.Lock()
+	columns, ok := s.tables[table]
+	s.lock.Unlock()
+	if ok {
+		return columns, nil
+	}
+	// The lock is not held while introspecting, as ops may be waiting for a connection held by
+	// another goroutine that is itself waiting for the lock.
+	introspected, err := d.Columns(ops, table)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to introspect table %q", table)
+	}
+	out := make(map[string]bool, len(introspected))
+	for _, column := range introspected {
+		out[column.Name] = true
+	}
+	if len(out) > 0 {
+		s.lock.Lock()
+		s.tables[table] = out
+		s.lock.Unlock()
+	}
+	return out, nil
+}
+
+// Returns a copy of b that only includes fields with a column in table.
+func (s *schema) restrict(table string, b *builder) *builder {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	key := schemaKey{builder: b, table: table}
+	if restricted, ok := s.builders[key]; ok {
+		return restricted
+	}
+	columns := s.tables[table]
+	out := &builder{t: b.t, fieldMap: map[string]field{}}
+	for _, name := range b.fields {
+		field := b.fieldMap[name]
+		if field.table == "" && !columns[name] {
+			if s.warn != nil {
+				s.warn(table, name)
+			}
+			continue
+		}
+		if name == b.pk {
+			out.pk = b.pk
+		}
+		out.fields = append(out.fields, name)
+		out.fieldMap[name] = field
+	}
+	s.builders[key] = out
+	return out
+}
+
+// Returns b restricted to the columns of the mapper's table, if any, for expanding "**" and for the
+// columns of Insert and Upsert. Results are always scanned with the full builder, so that aliased and
+// computed columns can be selected.
+func (m *mapper) restrict(b *builder) *builder {
+	if m.table == "" {
+		return b
+	}
+	return m.schema.restrict(m.table, b)
+}
+
+// Returns true unless the mapper is restricted to a table that has no column for field. As with
+// restrict, fields of nested structs are not restricted.
+func (m *mapper) hasColumn(field field) bool {
+	if m.table == "" || field.table != "" {
+		return true
+	}
+	m.schema.lock.Lock()
+	defer m.schema.lock.Unlock()
+	return m.schema.tables[m.table][field.name]
+}
+
+// Returns a mapper restricted to the columns of table, if schema introspection is enabled.
+func (m *mapper) forTable(ops sqlOps, d dialect, table string) (*mapper, error) {
+	if m.schema == nil || table == "" {
+		return m, nil
+	}
+	columns, err := m.schema.columns(ops, d, table)
+	if err != nil {
+		return nil, err
+	}
+	// Unknown tables, eg. views or CTEs, are not restricted.
+	if len(columns) == 0 {
+		return m, nil
+	}
+	out := *m
+	out.table = table
+	return &out, nil
+}
+
+// Returns a mapper restricted to the columns of the table targeted by query.
+func (m *mapper) forQuery(ops sqlOps, d dialect, query string) (*mapper, error) {
+	if m.schema == nil {
+		return m, nil
+	}
+	return m.forTable(ops, d, targetTable(query))
+}
+
+// Tables returns the names of the tables in the current database or schema.
+func (q *DB) Tables() ([]string, error) {
+	tables, err := q.dialect.Tables(q.db)
+	return tables, errors.Wrap(err, "failed to list tables")
+}
+
+// Columns returns the columns of table, in order. It returns no columns if the table does not exist.
+//
+// The table may be qualified with a schema, eg. "public.users".
+func (q *DB) Columns(table string) ([]Column, error) {
+	columns, err := q.dialect.Columns(q.db, table)
+	return columns, errors.Wrapf(err, "failed to introspect table %q", table)
+}
+
+// Validate checks that the fields of row, a struct or pointer to a struct, map to the columns of
+// table. It is intended to be called at startup for each mapped type, so that mismatches fail
+// fast rather than on first use.
+//
+// An error is returned listing each field without a column, each field whose type is incompatible
+// with the type of its column, each non-nullable field mapped to a nullable column, and each field
+// mapped to a column with a default or auto-increment value that is not tagged "managed". Fields of
+// nested structs are not validated.
+func (q *DB) Validate(row interface{}, table string) error {
+	builder, err := q.mapper.makeRowBuilder(row)
+	if err != nil {
+		return errors.Wrapf(err, "failed to map type %T", row)
+	}
+	columns, err := q.Columns(table)
+	if err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		return errors.Errorf("table %q does not exist", table)
+	}
+	columnMap := make(map[string]Column, len(columns))
+	for _, column := range columns {
+		columnMap[column.Name] = column
+	}
+	problems := []string{}
+	for _, name := range builder.fields {
+		field := builder.fieldMap[name]
+		if field.table != "" {
+			continue
+		}
+		column, ok := columnMap[name]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("field %s has no column", name))
+		case !isCompatibleField(field, column.Type):
+			problems = append(problems, fmt.Sprintf("column %s of type %s is incompatible with field %s of type %s", name, column.Type, name, field.t))
+		case column.Nullable && !isNullableField(field):
+			problems = append(problems, fmt.Sprintf("column %s is nullable but field %s is of non-nullable type %s", name, name, field.t))
+		}
+		if ok && (column.HasDefault || column.AutoIncrement) && !field.managed {
+			problems = append(problems, fmt.Sprintf("column %s has a database assigned value but field %s is not tagged managed", name, name))
+		}
+	}
+	if len(problems) > 0 {
+		return errors.Errorf("%s does not match table %q: %s", builder.t, table, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Returns true if NULL can be scanned into field.
+func isNullableField(field field) bool {
+	if field.json || field.array || field.codec != nil || isByteArrayType(field.t) {
+		return true
+	}
+	switch field.t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+		return true
+	}
+	return reflect.PtrTo(field.t).Implements(scannerType)
+}
+
+// Returns false if values of the given database column type clearly can not be scanned into field,
+// eg. an INTEGER column into a string field. Fields with a codec, or that implement sql.Scanner, and
+// unknown column types are assumed to be compatible.
+func isCompatibleField(field field, columnType string) bool {
+	t := indirectType(field.t)
+	if field.json || field.array || field.codec != nil || t == byteSliceType || isByteArrayType(t) ||
+		reflect.PtrTo(t).Implements(scannerType) {
+		return true
+	}
+	class := syntax.ClassifyType(columnType)
+	if class == syntax.UnknownClass {
+		return true
+	}
+	if t == timeType {
+		return class == syntax.TimeClass || class == syntax.StringClass
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return class != syntax.BoolClass && class != syntax.IntClass && class != syntax.FloatClass
+	case reflect.Bool:
+		return class == syntax.BoolClass || class == syntax.IntClass
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return class == syntax.IntClass || class == syntax.FloatClass || class == syntax.DecimalClass ||
+			class == syntax.BoolClass
+	}
+	return true
+}
@@ -0,0 +1,177 @@
+package sequel
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// A struct field of a tuple selected by SelectTuples.
+type tupleMember struct {
+	// Name the member's result columns may be qualified with, eg. "u" for "u.id".
+	name string
+	// Table or alias qualifying the member's columns when expanding "**".
+	table   string
+	builder *builder
+}
+
+// Creates a builder for a tuple type from the cached builders of each of its members.
+//
+// Fields of the tuple builder are named "<member>.<column>", and are expanded by "**" to
+// "<table>.<column> AS <member>.<column>".
+func (m *mapper) makeTupleBuilder(slice interface{}) (*builder, []tupleMember, error) {
+	t := reflect.TypeOf(slice)
+	if t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Slice || indirectType(t.Elem().Elem()).Kind() != reflect.Struct {
+		return nil, nil, errors.Errorf("expected a pointer to a slice of structs but got %T", slice)
+	}
+	t = indirectType(t.Elem().Elem())
+	out := &builder{t: t, fieldMap: map[string]field{}}
+	members := []tupleMember{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Tag.Get("db") == "-" {
+			continue
+		}
+		ft := f.Type
+		nullable := ft.Kind() == reflect.Ptr
+		if nullable {
+			ft = ft.Elem()
+		}
+		if ft.Kind() != reflect.Struct || ft == timeType {
+			return nil, nil, errors.Errorf("field %s: tuple fields must be structs or pointers to structs, not %s", f.Name, f.Type)
+		}
+		group, err := m.parseField(f, []int{i})
+		if err != nil {
+			return nil, nil, err
+		}
+		if group.pk || group.managed {
+			return nil, nil, errors.Errorf("field %s: tuple fields can not be tagged pk or managed", f.Name)
+		}
+		builder, err := m.makeRowBuilderForType(ft)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "field %s", f.Name)
+		}
+		member := tupleMember{name: group.name, table: group.name, builder: builder}
+		if reflect.PtrTo(ft).Implements(tableNamerType) {
+			member.table = reflect.New(ft).Interface().(tableNamer).TableName()
+		}
+		for _, name := range builder.fields {
+			field := builder.fieldMap[name]
+			field.index = append([]int{i}, field.index...)
+			field.nullable = field.nullable || nullable
+			if field.table == "" {
+				field.table = member.table
+				field.group = member.name
+			}
+			field.name = member.name + "." + name
+			out.fields = append(out.fields, field.name)
+			out.fieldMap[field.name] = field
+		}
+		members = append(members, member)
+	}
+	if len(members) == 0 {
+		return nil, nil, errors.Errorf("tuple %s has no fields", t)
+	}
+	return out, members, nil
+}
+
+// Assign each result column to a member of the tuple, returning the names of the corresponding
+// fields of the tuple builder, or "" for unmapped columns.
+//
+// Columns qualified with the name or table of a member, eg. "u.id", are assigned to that member.
+// Other columns are assigned in order: to the current member if it has a field for the column that
+// has not already been assigned, otherwise to the next member that does. This splits the results
+// of queries such as "SELECT u.*, a.* FROM users u JOIN accounts a ON ...".
+func assignTupleColumns(members []tupleMember, columns []string) []string {
+	out := make([]string, len(columns))
+	assigned := map[string]bool{}
+	current := 0
+	for i, column := range columns {
+		if dot := strings.Index(column, "."); dot >= 0 {
+			for _, member := range members {
+				qualifier, name := column[:dot], column[dot+1:]
+				if _, ok := member.builder.fieldMap[name]; ok && (qualifier == member.name || qualifier == member.table) {
+					out[i] = member.name + "." + name
+					break
+				}
+			}
+			if out[i] != "" {
+				assigned[out[i]] = true
+				continue
+			}
+		}
+		for j := current; j < len(members); j++ {
+			name := members[j].name + "." + column
+			if _, ok := members[j].builder.fieldMap[column]; ok && !assigned[name] {
+				out[i] = name
+				assigned[name] = true
+				current = j
+				break
+			}
+		}
+	}
+	return out
+}
+
+// SelectTuples issues a query and scans each row into several independent structs, eg. for joins.
+//
+// "slice" must be a pointer to a slice of structs (the tuple), each of whose fields is a struct or
+// pointer to a struct mapped as if by Select. Pointer fields are nil if all of their columns are
+// NULL, eg. for LEFT JOINs. eg.
+//
+// 		rows := []struct{
+// 			User    User    `db:"u"`
+// 			Account *Account `db:"a"`
+// 		}{}
+// 		err := db.SelectTuples(&rows, "SELECT u.*, a.* FROM users u LEFT JOIN accounts a ON a.user_id = u.id")
+//
+// Result columns are split between the fields of the tuple in order, so columns with the same name
+// such as "id" do not collide. Columns may also be qualified explicitly with the field's name, eg.
+// "a.id". "**" expands to the columns of every field, qualified with the table name of the field's
+// type (if it implements TableName() string) or the field's name.
+//
+// Columns are not restricted by WithSchemaIntrospection, as the fields are mapped to different tables.
+func (q *queryable) SelectTuples(slice interface{}, query string, args ...interface{}) error {
+	builder, members, err := q.mapper.makeTupleBuilder(slice)
+	if err != nil {
+		return errors.Wrapf(err, "failed to map slice %T", slice)
+	}
+	rows, columns, err := q.query(q.mapper, builder, query, args...)
+	if err != nil {
+		return errors.Wrapf(err, "failed to prepare select %q", query)
+	}
+	defer rows.Close()
+	fields := assignTupleColumns(members, columns)
+	mapping := fmt.Sprintf("(%s) -> (%s)", strings.Join(columns, ","), strings.Join(fields, ","))
+
+	// Strict checks.
+	mapped := 0
+	for i, field := range fields {
+		if field != "" {
+			mapped++
+		} else if q.mode&IgnoreUnmappedColumns == 0 {
+			return errors.Errorf("no field in (%s) maps to result column %q", strings.Join(builder.fields, ", "), columns[i])
+		}
+	}
+	if mapped != len(builder.fields) && q.mode&AllowMissingFields == 0 {
+		return errors.Errorf("invalid mapping %s", mapping)
+	}
+
+	out := reflect.ValueOf(slice).Elem()
+	addrElem := out.Type().Elem().Kind() == reflect.Ptr
+	for rows.Next() {
+		el := reflect.New(builder.t).Elem()
+		err = builder.scan(q.mapper, rows, el, fields)
+		if err != nil {
+			return errors.Wrap(classifyError(q.dialect, err), mapping)
+		}
+		if addrElem {
+			el = el.Addr()
+		}
+		out = reflect.Append(out, el)
+	}
+	reflect.ValueOf(slice).Elem().Set(out)
+	return classifyError(q.dialect, rows.Err())
+}
@@ -0,0 +1,19 @@
+// Command sequel-vet checks calls to Sequel for mistakes that would otherwise only be reported at
+// runtime, such as mismatched placeholder counts and invalid struct tags.
+//
+// eg.
+//
+// 		sequel-vet ./...
+//
+// It can also be run by "go vet" with "go vet -vettool=$(which sequel-vet) ./...".
+package main
+
+import (
+	"golang.org/x/tools/go/analysis/singlechecker"
+
+	"github.com/alecthomas/sequel/vet"
+)
+
+func main() {
+	singlechecker.Main(vet.Analyzer)
+}
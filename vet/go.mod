@@ -0,0 +1,14 @@
+module github.com/alecthomas/sequel/vet
+
+go 1.25.0
+
+require (
+	github.com/alecthomas/sequel v0.0.0-20261018144641-726ffbd9548f
+	golang.org/x/tools v0.47.0
+)
+
+require (
+	github.com/pkg/errors v0.8.1 // indirect
+	golang.org/x/mod v0.37.0 // indirect
+	golang.org/x/sync v0.21.0 // indirect
+)
@@ -0,0 +1,80 @@
+package a
+
+import (
+	"database/sql"
+	"net"
+	"time"
+
+	"github.com/alecthomas/sequel"
+)
+
+type User struct {
+	ID      int64 `db:"id,pk,managed"`
+	Name    string
+	Created time.Time `db:",managed"`
+	IP      net.IP
+	Tags    []string          `db:",array"`
+	Data    map[string]string `db:",json"`
+	UUID    [16]byte          `db:",uuid"`
+	Ignored []string          `db:"-"`
+}
+
+type Account struct {
+	ID   int64
+	User *User `db:"user,prefix"`
+}
+
+type BadTag struct {
+	ID int64 `db:"id,pkk"`
+}
+
+type BadFields struct {
+	Tags    []string
+	Hash    [32]byte `db:",uuid"`
+	Name    string   `db:",prefix"`
+	Account Account  `db:",pk"`
+	Numbers []int    `db:",json"`
+	Blob    []byte   `db:",array"`
+}
+
+type Node struct {
+	ID     int64
+	Parent *Node
+}
+
+func queries(db *sequel.DB, iface sequel.Interface, args []interface{}) {
+	users := []User{}
+	_ = db.Select(&users, `SELECT ** FROM users WHERE id = ? AND name = ?`, 1, "larry")
+	_ = db.Select(&users, `SELECT ** FROM users WHERE id = ?`)                         // want `query has 1 placeholders but 0 arguments were provided`
+	_ = iface.Select(&users, `SELECT ** FROM users WHERE name = '?' AND id = ?`, 1, 2) // want `query has 1 placeholders but 2 arguments were provided`
+	_ = db.Select(&users, `SELECT ** FROM users WHERE id IN (?)`, args...)
+	_, _ = db.Exec(`INSERT INTO users (**) VALUES ?`, users)
+	_, _ = iface.Exec(`DELETE FROM users WHERE id = ?`) // want `query has 1 placeholders but 0 arguments were provided`
+	_, _, _ = db.Expand(`SELECT ?`, true, 1)
+	_, _, _ = db.Expand(`SELECT ** FROM users`, true, users)
+	_, _ = db.SelectInt(`SELECT COUNT(*) FROM users WHERE id > ?`) // want `query has 1 placeholders but 0 arguments were provided`
+	query := "SELECT ?"
+	_ = db.SelectOne(&User{}, query)
+
+	_ = db.Select(&[]Account{}, `SELECT ** FROM accounts`)
+	_ = db.Select(&[]Node{}, `SELECT ** FROM nodes`)
+	_ = db.Select(&[]sequel.Row{}, `SELECT * FROM nodes`)
+	_ = db.Select(&[]sql.NullString{}, `SELECT name FROM nodes`)
+	_ = db.SelectMap(&map[int64]*BadTag{}, `SELECT ** FROM bad WHERE id = ?`, 1) // want `invalid tag attribute "pkk"`
+	_ = db.SelectMap(&map[string]int{}, `SELECT name, COUNT(*) FROM users`, 1)   // want `query has 0 placeholders but 1 arguments were provided`
+	_ = db.Select(&[]map[string]interface{}{}, `SELECT * FROM nodes`)
+	_ = db.SelectOne(&BadTag{}, `SELECT ** FROM bad`)    // want `a.BadTag: field ID: invalid tag attribute "pkk"`
+	_ = db.Select(&[]*BadFields{}, `SELECT ** FROM bad`) // want `field Tags: can't select into slice field "\[\]string"` `field Hash: only \[16\]byte fields can be tagged uuid` `field Name: only struct fields can be tagged prefix` `field Account: struct fields can not be tagged pk or managed` `field Blob: only slice fields can be tagged array`
+}
+
+func inserts(db *sequel.DB) {
+	_, _ = db.Insert("users", &User{})
+	_, _ = db.Insert("users", []*User{{}})
+	_, _ = db.Insert("users", &User{}, &User{})
+	_, _ = db.Insert("users", User{})          // want `can't set PK on value a.User, must be \*a.User`
+	_, _ = db.Insert("users", []User{{}})      // want `can't set PK on value a.User, must be \*a.User`
+	_, _ = db.Insert("users", &User{}, User{}) // want `can't set PK on value a.User, must be \*a.User`
+	_, _ = db.Insert("accounts", Account{})
+	_, _ = db.Upsert("users", []string{"id"}, User{})
+	_, _ = db.Upsert("bad", []string{"id"}, BadTag{}) // want `invalid tag attribute "pkk"`
+}
@@ -0,0 +1,37 @@
+// Package sequel is a stub of the methods checked by the analyzer.
+package sequel
+
+import "database/sql"
+
+type Interface interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Select(slice interface{}, query string, args ...interface{}) error
+}
+
+type DB struct{ queryable }
+
+type Row struct {
+	Columns []string
+	Values  []interface{}
+}
+
+type queryable struct{}
+
+func (q *queryable) Insert(table string, rows ...interface{}) ([]int64, error) { return nil, nil }
+func (q *queryable) Upsert(table string, keys []string, rows ...interface{}) (sql.Result, error) {
+	return nil, nil
+}
+func (q *queryable) Expand(query string, withManaged bool, args ...interface{}) (string, []interface{}, error) {
+	return "", nil, nil
+}
+func (q *queryable) Exec(query string, args ...interface{}) (sql.Result, error) { return nil, nil }
+func (q *queryable) Select(slice interface{}, query string, args ...interface{}) error {
+	return nil
+}
+func (q *queryable) SelectMap(ref interface{}, query string, args ...interface{}) error {
+	return nil
+}
+func (q *queryable) SelectOne(ref interface{}, query string, args ...interface{}) error {
+	return nil
+}
+func (q *queryable) SelectInt(query string, args ...interface{}) (int, error) { return 0, nil }
@@ -0,0 +1,302 @@
+// Package vet provides an analyzer that checks calls to Sequel for mistakes that would otherwise
+// only be reported at runtime.
+package vet
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"reflect"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+	"golang.org/x/tools/go/types/typeutil"
+
+	"github.com/alecthomas/sequel/internal/syntax"
+)
+
+const sequelPath = "github.com/alecthomas/sequel"
+
+const doc = `check calls to Sequel
+
+Checks that:
+
+- Constant query strings have as many "?" placeholders as there are arguments.
+- "db" struct tags of selected or inserted types are valid.
+- Fields of selected or inserted types can be mapped.
+- Insert is not passed a value with a "pk" field, which can't be set, rather than a pointer.`
+
+// Analyzer checks calls to Sequel.
+var Analyzer = &analysis.Analyzer{
+	Name:     "sequel",
+	Doc:      doc,
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      run,
+}
+
+type queryArgs struct {
+	query int // Index of the query argument.
+	args  int // Index of the first query argument.
+	// Without a row type, "**" takes its type from the argument at the next placeholder, so the
+	// number of arguments can't be checked.
+	wildcardArg bool
+}
+
+// Methods that accept a query and arguments.
+var queryMethods = map[string]queryArgs{
+	"Select":       {1, 2, false},
+	"SelectOne":    {1, 2, false},
+	"SelectTuples": {1, 2, false},
+	"SelectMap":    {1, 2, false},
+	"SelectScalar": {1, 2, false},
+	"SelectInt":    {0, 1, false},
+	"SelectString": {0, 1, false},
+	"Exec":         {0, 1, true},
+	"Update":       {0, 1, true},
+	"Expand":       {0, 2, true},
+}
+
+// Types whose methods are checked.
+var receivers = map[string]bool{
+	"Interface":   true,
+	"Querier":     true,
+	"DB":          true,
+	"Transaction": true,
+	"queryable":   true,
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+	inspect.Preorder([]ast.Node{(*ast.CallExpr)(nil)}, func(node ast.Node) {
+		call := node.(*ast.CallExpr)
+		fn, ok := typeutil.Callee(pass.TypesInfo, call).(*types.Func)
+		if !ok || fn.Pkg() == nil || fn.Pkg().Path() != sequelPath || !receivers[receiverName(fn)] {
+			return
+		}
+		name := fn.Name()
+		if q, ok := queryMethods[name]; ok {
+			checkPlaceholders(pass, call, q)
+		}
+		switch name {
+		case "Select", "SelectOne", "SelectTuples", "SelectMap", "SelectNamed", "SelectOneNamed":
+			if len(call.Args) > 0 {
+				checkType(pass, call.Pos(), pass.TypesInfo.TypeOf(call.Args[0]))
+			}
+		case "Insert":
+			checkRows(pass, call, 1, true)
+		case "Upsert":
+			checkRows(pass, call, 2, false)
+		}
+	})
+	return nil, nil
+}
+
+func checkPlaceholders(pass *analysis.Pass, call *ast.CallExpr, q queryArgs) {
+	if call.Ellipsis.IsValid() || len(call.Args) <= q.query {
+		return
+	}
+	value := pass.TypesInfo.Types[call.Args[q.query]].Value
+	if value == nil || value.Kind() != constant.String {
+		return
+	}
+	query := constant.StringVal(value)
+	if q.wildcardArg && hasWildcard(query) {
+		return
+	}
+	placeholders := syntax.Placeholders(query)
+	args := len(call.Args) - q.args
+	if args < 0 {
+		args = 0
+	}
+	if placeholders != args {
+		pass.Reportf(call.Args[q.query].Pos(), "query has %d placeholders but %d arguments were provided", placeholders, args)
+	}
+}
+
+func checkRows(pass *analysis.Pass, call *ast.CallExpr, first int, insert bool) {
+	if call.Ellipsis.IsValid() {
+		return
+	}
+	for i := first; i < len(call.Args); i++ {
+		t := pass.TypesInfo.TypeOf(call.Args[i])
+		if !checkType(pass, call.Pos(), t) || !insert {
+			continue
+		}
+		// Insert can only set the PK of rows passed by reference.
+		elem := t
+		if slice, ok := elem.Underlying().(*types.Slice); ok && len(call.Args)-first == 1 {
+			elem = slice.Elem()
+		}
+		if st, ok := elem.Underlying().(*types.Struct); ok && hasPK(st) {
+			pass.Reportf(call.Args[i].Pos(), "can't set PK on value %s, must be *%s", elem, elem)
+		}
+	}
+}
+
+// Check the fields of the struct type underlying t, if any. Returns false if t is not a struct,
+// or a pointer, slice or map of struct, or if the struct is scanned from a single column.
+func checkType(pass *analysis.Pass, pos token.Pos, t types.Type) bool {
+	if t == nil {
+		return false
+	}
+	for {
+		// Rows are mapped dynamically.
+		if named, ok := t.(*types.Named); ok && named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == sequelPath && named.Obj().Name() == "Row" {
+			return false
+		}
+		if isTime(t) || isScanner(t) {
+			return false
+		}
+		switch u := t.Underlying().(type) {
+		case *types.Pointer:
+			t = u.Elem()
+			continue
+		case *types.Slice:
+			t = u.Elem()
+			continue
+		case *types.Map:
+			t = u.Elem()
+			continue
+		case *types.Struct:
+			checkStruct(pass, pos, t, u, map[types.Type]bool{})
+			return true
+		}
+		return false
+	}
+}
+
+// Mirrors the rules of collectFieldIndexes and parseField.
+func checkStruct(pass *analysis.Pass, pos token.Pos, named types.Type, st *types.Struct, seen map[types.Type]bool) {
+	if seen[named] {
+		return
+	}
+	seen[named] = true
+	for i := 0; i < st.NumFields(); i++ {
+		f := st.Field(i)
+		value, ok := reflect.StructTag(st.Tag(i)).Lookup("db")
+		if value == "-" {
+			continue
+		}
+		tag := syntax.Tag{}
+		if ok {
+			var err error
+			tag, err = syntax.ParseTag(value)
+			if err != nil {
+				pass.Reportf(pos, "%s: field %s: %s", named, f.Name(), err)
+				continue
+			}
+		}
+		ft := f.Type()
+		report := func(format string, args ...interface{}) {
+			pass.Reportf(pos, "%s: field %s: "+format, append([]interface{}{named, f.Name()}, args...)...)
+		}
+		if tag.Array && (!isSlice(ft) || isByteSlice(ft)) {
+			report("only slice fields can be tagged array")
+		}
+		if tag.UUID && !isByteArray(ft, 16) {
+			report("only [16]byte fields can be tagged uuid")
+		}
+		if isTime(ft) || isByteSlice(ft) || isByteArray(ft, -1) || isScanner(ft) || tag.JSON || tag.Array {
+			if tag.Prefix {
+				report("only struct fields can be tagged prefix")
+			}
+			continue
+		}
+		if ptr, ok := ft.(*types.Pointer); ok {
+			if _, ok := ptr.Elem().Underlying().(*types.Struct); ok {
+				ft = ptr.Elem()
+			}
+		}
+		switch u := ft.Underlying().(type) {
+		case *types.Struct:
+			if !f.Anonymous() && (tag.PK || tag.Managed) {
+				report("struct fields can not be tagged pk or managed")
+			}
+			checkStruct(pass, pos, ft, u, seen)
+		case *types.Slice, *types.Array:
+			// Named types such as net.IP may be mapped by a codec registered at runtime.
+			if _, named := ft.(*types.Named); !named {
+				report("can't select into slice field %q", ft)
+			}
+		default:
+			if tag.Prefix {
+				report("only struct fields can be tagged prefix")
+			}
+		}
+	}
+}
+
+// Name of the type fn is a method of, or "".
+func receiverName(fn *types.Func) string {
+	recv := fn.Type().(*types.Signature).Recv()
+	if recv == nil {
+		return ""
+	}
+	t := recv.Type()
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	if named, ok := t.(*types.Named); ok {
+		return named.Obj().Name()
+	}
+	return ""
+}
+
+func hasWildcard(query string) bool {
+	for _, match := range syntax.Lexer.FindAllStringSubmatch(query, -1) {
+		if match[3] == "**" {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if st has a top-level field tagged "pk".
+func hasPK(st *types.Struct) bool {
+	for i := 0; i < st.NumFields(); i++ {
+		tag, err := syntax.ParseTag(reflect.StructTag(st.Tag(i)).Get("db"))
+		if err == nil && tag.PK {
+			return true
+		}
+		if st.Field(i).Anonymous() {
+			if embedded, ok := st.Field(i).Type().Underlying().(*types.Struct); ok && hasPK(embedded) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isSlice(t types.Type) bool {
+	_, ok := t.Underlying().(*types.Slice)
+	return ok
+}
+
+func isByteSlice(t types.Type) bool {
+	slice, ok := t.Underlying().(*types.Slice)
+	return ok && isByte(slice.Elem())
+}
+
+// Returns true if t is a byte array of length n, or of any length if n is negative.
+func isByteArray(t types.Type, n int64) bool {
+	array, ok := t.Underlying().(*types.Array)
+	return ok && isByte(array.Elem()) && (n < 0 || array.Len() == n)
+}
+
+func isByte(t types.Type) bool {
+	basic, ok := t.Underlying().(*types.Basic)
+	return ok && basic.Kind() == types.Byte
+}
+
+func isTime(t types.Type) bool {
+	named, ok := t.(*types.Named)
+	return ok && named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == "time" && named.Obj().Name() == "Time"
+}
+
+func isScanner(t types.Type) bool {
+	obj, _, _ := types.LookupFieldOrMethod(types.NewPointer(t), true, nil, "Scan")
+	_, ok := obj.(*types.Func)
+	return ok
+}